@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiError is a non-2xx response from the X API, with whatever fields of its
+// problem JSON could be parsed.
+type apiError struct {
+	Status int          `json:"status"`
+	Code   string       `json:"code,omitempty"`
+	Title  string       `json:"title,omitempty"`
+	Detail string       `json:"detail,omitempty"`
+	Type   string       `json:"type,omitempty"`
+	Errors []apiProblem `json:"errors,omitempty"`
+	// ResetAt is when X will accept requests again, from the rate-limit
+	// headers of the response.
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+	Body    string     `json:"-"`
+}
+
+// apiProblem is one entry of errors[]: v2 uses title/detail/type, v1.1 (still
+// returned by the media endpoints) uses a numeric code and message.
+type apiProblem struct {
+	Code    json.Number `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Title   string      `json:"title,omitempty"`
+	Detail  string      `json:"detail,omitempty"`
+	Type    string      `json:"type,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	if msg := e.summary(); msg != "" {
+		return fmt.Sprintf("Twitter API error %d: %s", e.Status, msg)
+	}
+	return fmt.Sprintf("Twitter API error %d: %s", e.Status, e.Body)
+}
+
+func (e *apiError) summary() string {
+	switch {
+	case e.Title != "" && e.Detail != "" && e.Title != e.Detail:
+		return e.Title + ": " + e.Detail
+	default:
+		return first(e.Detail, e.Title)
+	}
+}
+
+func newAPIError(status int, body []byte) *apiError {
+	e := &apiError{Status: status, Body: strings.TrimSpace(string(body))}
+	var p struct {
+		Title  string       `json:"title"`
+		Detail string       `json:"detail"`
+		Type   string       `json:"type"`
+		Errors []apiProblem `json:"errors"`
+	}
+	if json.Unmarshal(body, &p) != nil {
+		return e
+	}
+	e.Title, e.Detail, e.Type, e.Errors = p.Title, p.Detail, p.Type, p.Errors
+	if len(p.Errors) > 0 {
+		x := p.Errors[0]
+		e.Code = x.Code.String()
+		e.Title = first(e.Title, x.Title)
+		e.Detail = first(e.Detail, x.Detail, x.Message)
+		e.Type = first(e.Type, x.Type)
+	}
+	return e
+}
+
+// errorCode maps an X error to a CliErr code, or "" when nothing more
+// specific than the caller's code applies. Numeric codes are the v1.1 ones X
+// still returns; v2 only says it in the text.
+func (e *apiError) errorCode() string {
+	text := strings.ToLower(e.Type + " " + e.summary())
+	for _, x := range e.Errors {
+		text += " " + strings.ToLower(x.Type+" "+x.Title+" "+x.Detail+" "+x.Message)
+	}
+	has := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(text, w) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case e.Status == http.StatusTooManyRequests || e.Code == "88" || has("usage-capped"):
+		return "RATE_LIMITED"
+	case e.Code == "187" || has("duplicate"):
+		return "DUPLICATE"
+	case e.Code == "186" || has("too long", "text is too long"):
+		return "TOO_LONG"
+	case e.Code == "64" || e.Code == "326" || has("suspended", "locked"):
+		return "SUSPENDED"
+	case e.Status == http.StatusUnauthorized || e.Code == "32" || e.Code == "89":
+		return "UNAUTHORIZED"
+	case e.Status == http.StatusForbidden:
+		return "FORBIDDEN"
+	}
+	return ""
+}
+
+func (e *apiError) details() map[string]any {
+	d := map[string]any{"status": e.Status}
+	for k, v := range map[string]string{"xCode": e.Code, "title": e.Title, "detail": e.Detail, "type": e.Type} {
+		if v != "" {
+			d[k] = v
+		}
+	}
+	if len(e.Errors) > 0 {
+		d["errors"] = e.Errors
+	}
+	if e.ResetAt != nil {
+		d["resetAt"] = e.ResetAt.Format(time.RFC3339)
+	}
+	return d
+}
+
+var apiErrorHints = map[string]string{
+	"RATE_LIMITED": "Rate limited by X",
+	"DUPLICATE":    "X rejected the tweet as duplicate content",
+	"TOO_LONG":     "X rejected the tweet as too long",
+	"SUSPENDED":    "The X account is suspended or locked",
+	"UNAUTHORIZED": "X rejected the credentials",
+	"FORBIDDEN":    "X refused the request",
+}
+
+// apiFail turns a failed X API call into the CliErr callers see. Known X
+// errors get their own code and the parsed problem fields are merged into
+// details; anything else gets msg unchanged, and code unless err is a CliErr
+// with its own.
+func apiFail(code, msg string, err error, details map[string]any) error {
+	var ae *apiError
+	if !errors.As(err, &ae) {
+		// Errors that already carry a code, like MEDIA_TIMEOUT, keep it.
+		var ce *CliErr
+		if errors.As(err, &ce) {
+			code = ce.Code
+		}
+		return cliFail(code, msg, details)
+	}
+	for k, v := range ae.details() {
+		details[k] = v
+	}
+	c := ae.errorCode()
+	if c == "" {
+		return cliFail(code, msg, details)
+	}
+	msg = apiErrorHints[c]
+	if s := ae.summary(); s != "" && c != "RATE_LIMITED" {
+		msg += ": " + s
+	}
+	if c == "RATE_LIMITED" && ae.ResetAt != nil {
+		msg += "; resets at " + ae.ResetAt.Local().Format("15:04:05")
+	}
+	return cliFail(c, msg, details)
+}
+
+// attemptHistory caps how many attempts are kept on a tweet.
+const attemptHistory = 20
+
+// Attempt records one try at posting a tweet.
+type Attempt struct {
+	At         string `json:"at"`
+	OK         bool   `json:"ok"`
+	DryRun     bool   `json:"dry_run,omitempty"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// recordAttempt appends the outcome of a post to t and keeps Error in sync
+// with the latest failure.
+func recordAttempt(t *Tweet, err error, dry bool) {
+	a := Attempt{At: time.Now().UTC().Format(time.RFC3339), OK: err == nil, DryRun: dry}
+	t.Error = ""
+	if err != nil {
+		a.Error = err.Error()
+		var ae *apiError
+		if errors.As(err, &ae) {
+			a.HTTPStatus, a.Code, a.Title, a.Detail = ae.Status, ae.Code, ae.Title, ae.Detail
+		}
+		t.Error = a.Error
+	}
+	t.Attempts = append(t.Attempts, a)
+	if n := len(t.Attempts); n > attemptHistory {
+		t.Attempts = t.Attempts[n-attemptHistory:]
+	}
+}
+
+func describeAttempt(a Attempt) string {
+	s := a.At + " ok"
+	if !a.OK {
+		s = a.At + " failed"
+		if a.HTTPStatus != 0 {
+			s += " " + strconv.Itoa(a.HTTPStatus)
+		}
+		s += ": " + first(a.Detail, a.Title, a.Error)
+	}
+	if a.DryRun {
+		s += " (dry run)"
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAPIErrorParsing(t *testing.T) {
+	cases := []struct {
+		body                string
+		code, title, detail string
+	}{
+		{`{"title":"Forbidden","detail":"You are not allowed to create a Tweet with duplicate content.","type":"about:blank","status":403}`, "", "Forbidden", "You are not allowed to create a Tweet with duplicate content."},
+		{`{"errors":[{"code":187,"message":"Status is a duplicate."}]}`, "187", "", "Status is a duplicate."},
+		{`upstream timeout`, "", "", ""},
+	}
+	for _, c := range cases {
+		e := newAPIError(403, []byte(c.body))
+		if e.Code != c.code || e.Title != c.title || e.Detail != c.detail {
+			t.Fatalf("%s -> %+v", c.body, e)
+		}
+	}
+
+	tw := Tweet{}
+	recordAttempt(&tw, fmt.Errorf("upload a.png: %w", newAPIError(400, []byte(`{"title":"Invalid Request"}`))), false)
+	recordAttempt(&tw, errors.New("dial tcp: timeout"), true)
+	if len(tw.Attempts) != 2 || tw.Attempts[0].HTTPStatus != 400 || tw.Attempts[0].Title != "Invalid Request" || !tw.Attempts[1].DryRun || tw.Error != "dial tcp: timeout" {
+		t.Fatalf("tweet=%+v", tw)
+	}
+	for i := 0; i < attemptHistory; i++ {
+		recordAttempt(&tw, nil, false)
+	}
+	if len(tw.Attempts) != attemptHistory || tw.Error != "" {
+		t.Fatalf("attempts=%d error=%q", len(tw.Attempts), tw.Error)
+	}
+}
+
+func TestAPIFailMapsXErrors(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		code   string
+	}{
+		{403, `{"detail":"You are not allowed to create a Tweet with duplicate content.","type":"about:blank","title":"Forbidden","status":403}`, "DUPLICATE"},
+		{403, `{"errors":[{"code":186,"message":"Tweet needs to be a bit shorter."}]}`, "TOO_LONG"},
+		{403, `{"errors":[{"code":64,"message":"Your account is suspended and is not permitted to access this feature."}]}`, "SUSPENDED"},
+		{401, `{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`, "UNAUTHORIZED"},
+		{403, `{"title":"Forbidden","detail":"You are not permitted to perform this action.","type":"about:blank"}`, "FORBIDDEN"},
+		{429, `{"title":"Too Many Requests","detail":"Too Many Requests","type":"about:blank","status":429}`, "RATE_LIMITED"},
+		{400, `{"errors":[{"parameters":{"text":[""]},"message":"Invalid text"}],"title":"Invalid Request","detail":"One or more parameters to your request was invalid.","type":"https://api.twitter.com/2/problems/invalid-request"}`, "POST_FAILED"},
+	}
+	for _, c := range cases {
+		err := apiFail("POST_FAILED", "failed", newAPIError(c.status, []byte(c.body)), map[string]any{"id": "t1"})
+		ce := err.(*CliErr)
+		d := ce.Details.(map[string]any)
+		if ce.Code != c.code || d["status"] != c.status || d["id"] != "t1" {
+			t.Fatalf("%d %s -> %s %+v", c.status, c.body, ce.Code, d)
+		}
+	}
+	ce := apiFail("POST_FAILED", "failed", errors.New("dial tcp: timeout"), map[string]any{}).(*CliErr)
+	if ce.Code != "POST_FAILED" || ce.Msg != "failed" {
+		t.Fatalf("err=%+v", ce)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	oauth2Scopes        = "tweet.read tweet.write users.read offline.access media.write"
+	defaultRedirectPort = 8976
+	// tokenRefreshSkew refreshes access tokens this long before they expire
+	// so a request never goes out with one that lapses in flight.
+	tokenRefreshSkew = time.Minute
+)
+
+// loginTimeout bounds how long auth login waits for the browser redirect.
+var loginTimeout = 5 * time.Minute
+
+// tokenExchangeTimeout bounds a call to the token endpoint. Refreshes run
+// under the store lock, so this stays well under lockStaleAfter: a slow
+// endpoint must not let another process break a lock that is still held.
+var tokenExchangeTimeout = 10 * time.Second
+
+// openBrowser opens url in the user's browser; tests replace it.
+var openBrowser = func(u string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", u).Start()
+	case "darwin":
+		return exec.Command("open", u).Start()
+	default:
+		return exec.Command("xdg-open", u).Start()
+	}
+}
+
+func oauth2Path() string { return filepath.Join(dataDir(), "oauth2.json") }
+
+// oauth2Token is what auth login stores in the data dir.
+type oauth2Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope,omitempty"`
+	ExpiresAt    string `json:"expires_at,omitempty"`
+}
+
+func (t *oauth2Token) expiresSoon(now time.Time) bool {
+	at, err := time.Parse(time.RFC3339, t.ExpiresAt)
+	return err == nil && now.Add(tokenRefreshSkew).After(at)
+}
+
+// oauth2App is the registered X app used for OAuth 2.0 user-context auth.
+type oauth2App struct {
+	ClientID     string
+	ClientSecret string
+	AuthorizeURL string
+	TokenURL     string
+}
+
+func newOAuth2App(cfg Config) oauth2App {
+	base := apiBase(cfg)
+	authorize := "https://x.com/i/oauth2/authorize"
+	if base != defaultAPIBase {
+		authorize = base + "/i/oauth2/authorize"
+	}
+	return oauth2App{ClientID: cfg.OAuth2.ClientID, ClientSecret: cfg.OAuth2.ClientSecret, AuthorizeURL: authorize, TokenURL: base + "/2/oauth2/token"}
+}
+
+// authMode picks how twClient authenticates: XPOSTCTL_AUTH or config auth
+// ("oauth1" or "oauth2"); by default OAuth 2.0 once auth login has stored a
+// token, OAuth 1.0a keys otherwise.
+func authMode(cfg Config) string {
+	if m := strings.ToLower(first(strings.TrimSpace(os.Getenv("XPOSTCTL_AUTH")), cfg.Auth)); m == "oauth1" || m == "oauth2" {
+		return m
+	}
+	if _, err := os.Stat(oauth2Path()); err == nil {
+		return "oauth2"
+	}
+	return "oauth1"
+}
+
+// authorize sets the Authorization header on req: a Bearer token when the
+// client uses OAuth 2.0, an OAuth 1.0a signature over params otherwise.
+func (c twClient) authorize(req *http.Request, params map[string]string) error {
+	if c.oauth2 != nil {
+		tok, err := c.oauth2.accessToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+		return nil
+	}
+	u := *req.URL
+	u.RawQuery = ""
+	req.Header.Set("Authorization", sign(req.Method, u.String(), c.creds, params, "", ""))
+	return nil
+}
+
+// accessToken returns the stored access token, refreshing it first when it
+// is about to expire. The refresh holds the store lock because X rotates
+// refresh tokens: two processes refreshing at once would lose one.
+func (a oauth2App) accessToken() (string, error) {
+	tok, err := readJSON[*oauth2Token](oauth2Path(), nil)
+	if err != nil {
+		return "", err
+	}
+	if tok == nil || tok.AccessToken == "" {
+		return "", cliFail("UNAUTHORIZED", "No OAuth 2.0 token; run `xpostctl auth login`", map[string]any{"tokenFile": oauth2Path()})
+	}
+	if !tok.expiresSoon(time.Now()) {
+		return tok.AccessToken, nil
+	}
+	err = withLock(func() error {
+		cur, err := readJSON[*oauth2Token](oauth2Path(), nil)
+		if err != nil {
+			return err
+		}
+		if cur == nil || cur.AccessToken == "" {
+			return cliFail("UNAUTHORIZED", "No OAuth 2.0 token; run `xpostctl auth login`", map[string]any{"tokenFile": oauth2Path()})
+		}
+		if !cur.expiresSoon(time.Now()) {
+			tok = cur
+			return nil
+		}
+		// Refresh with the token as stored now: another process may have
+		// rotated it since tok was read, and X rejects the old one.
+		if cur.RefreshToken == "" {
+			return cliFail("UNAUTHORIZED", "OAuth 2.0 token expired and has no refresh token; run `xpostctl auth login`", nil)
+		}
+		next, err := a.exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {cur.RefreshToken}})
+		if err != nil {
+			return cliFail("UNAUTHORIZED", "Refreshing the OAuth 2.0 token failed: "+err.Error()+"; run `xpostctl auth login`", nil)
+		}
+		next.RefreshToken = first(next.RefreshToken, cur.RefreshToken)
+		tok = next
+		return writeJSON(oauth2Path(), tok)
+	})
+	if err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+// exchange posts a grant to the token endpoint. Confidential clients
+// authenticate with HTTP Basic; public clients send client_id in the form.
+func (a oauth2App) exchange(form url.Values) (*oauth2Token, error) {
+	form.Set("client_id", a.ClientID)
+	req, err := http.NewRequest(http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if a.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+	client := *xHTTPClient
+	if client.Timeout == 0 || client.Timeout > tokenExchangeTimeout {
+		client.Timeout = tokenExchangeTimeout
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, newAPIError(res.StatusCode, b)
+	}
+	var out struct {
+		oauth2Token
+		ExpiresIn int `json:"expires_in"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	if out.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+	tok := out.oauth2Token
+	if out.ExpiresIn > 0 {
+		tok.ExpiresAt = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second).UTC().Format(time.RFC3339)
+	}
+	return &tok, nil
+}
+
+func randomURLSafe(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func authCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) == 0 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet auth <login|logout|status|set>", map[string]any{"examples": []string{"tweet auth login [--port 8976] [--no-browser]", "tweet auth logout", "tweet auth status", "tweet auth set apiKey", "tweet auth set --import"}})
+	}
+	switch args[0] {
+	case "login":
+		return authLoginCmd(args[1:], ctx)
+	case "logout":
+		return authLogoutCmd(ctx)
+	case "set":
+		return authSetCmd(args[1:], ctx)
+	case "status":
+		// auth status is doctor that always asks X who the credentials belong to.
+		if len(args) > 1 {
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet auth status", nil)
+		}
+		return doctorCmd([]string{"--verify"}, ctx)
+	default:
+		return nil, cliFail("INVALID_ARGS", "Unknown auth subcommand: "+args[0], map[string]any{"available": []string{"login", "logout", "status", "set"}})
+	}
+}
+
+// authLoginCmd runs the OAuth 2.0 Authorization Code flow with PKCE: it
+// listens on a loopback redirect URI, sends the user to X to approve, and
+// trades the returned code for tokens.
+func authLoginCmd(args []string, ctx Ctx) (any, error) {
+	port, browser := defaultRedirectPort, true
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--port" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 || n > 65535 {
+				return nil, cliFail("INVALID_ARGS", "Invalid --port: "+args[i+1], nil)
+			}
+			port = n
+			i++
+		case args[i] == "--no-browser":
+			browser = false
+		default:
+			return nil, cliFail("INVALID_ARGS", "Unknown flag: "+args[i], nil)
+		}
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	app := newOAuth2App(cfg)
+	if app.ClientID == "" {
+		return nil, cliFail("INVALID_ARGS", "No OAuth 2.0 client id; set X_CLIENT_ID (and X_CLIENT_SECRET for confidential apps) or oauth2.clientId in config.json", nil)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		return nil, cliFail("AUTH_FAILED", "Cannot listen for the OAuth redirect: "+err.Error(), map[string]any{"hint": "pick another --port and register its callback URL in the X developer portal"})
+	}
+	defer ln.Close()
+	redirect := fmt.Sprintf("http://127.0.0.1:%d/callback", ln.Addr().(*net.TCPAddr).Port)
+	verifier, state := randomURLSafe(48), randomURLSafe(24)
+	authURL := app.AuthorizeURL + "?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {app.ClientID},
+		"redirect_uri":          {redirect},
+		"scope":                 {oauth2Scopes},
+		"state":                 {state},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	type result struct{ code, err string }
+	done := make(chan result, 1)
+	srv := &http.Server{ReadHeaderTimeout: 10 * time.Second, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		// A redirect without our state is not the answer to this login (a
+		// stale tab, another app, a forged link); refuse it and keep waiting.
+		if q.Get("state") != state {
+			http.Error(w, "xpostctl login failed: state mismatch", http.StatusBadRequest)
+			return
+		}
+		res := result{code: q.Get("code")}
+		switch {
+		case q.Get("error") != "":
+			res.err = first(q.Get("error_description"), q.Get("error"))
+		case res.code == "":
+			res.err = "no authorization code in redirect"
+		}
+		if res.err != "" {
+			http.Error(w, "xpostctl login failed: "+res.err, http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "xpostctl is authorized. You can close this window.")
+		}
+		select {
+		case done <- res:
+		default:
+		}
+	})}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	if !ctx.JSON {
+		fmt.Println("  Open this URL to authorize xpostctl:")
+		fmt.Println(" ", authURL)
+		fmt.Println("  Waiting for the redirect to", redirect)
+	}
+	if browser {
+		_ = openBrowser(authURL)
+	}
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(loginTimeout):
+		return nil, cliFail("AUTH_FAILED", "Timed out waiting for authorization", map[string]any{"redirectUri": redirect})
+	}
+	if res.err != "" {
+		return nil, cliFail("AUTH_FAILED", "Authorization failed: "+res.err, nil)
+	}
+	tok, err := app.exchange(url.Values{"grant_type": {"authorization_code"}, "code": {res.code}, "redirect_uri": {redirect}, "code_verifier": {verifier}})
+	if err != nil {
+		return nil, apiFail("AUTH_FAILED", "Token exchange failed: "+err.Error(), err, map[string]any{})
+	}
+	if err := writeJSON(oauth2Path(), tok); err != nil {
+		return nil, err
+	}
+	// A new login may be a different X account; post looks it up again.
+	_ = os.Remove(accountPath())
+	if !ctx.JSON {
+		fmt.Println("  Logged in; token saved to", oauth2Path())
+		if tok.RefreshToken == "" {
+			fmt.Println("  Warning: no refresh token (offline.access not granted); you will need to log in again when it expires")
+		}
+	}
+	return map[string]any{"tokenFile": oauth2Path(), "scope": tok.Scope, "expiresAt": tok.ExpiresAt, "refreshable": tok.RefreshToken != ""}, nil
+}
+
+func authLogoutCmd(ctx Ctx) (any, error) {
+	if err := ensureData(); err != nil {
+		return nil, err
+	}
+	removed := false
+	for _, p := range []string{oauth2Path(), oauth2Path() + ".bak", accountPath()} {
+		if err := os.Remove(p); err == nil {
+			removed = removed || p == oauth2Path()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if !ctx.JSON {
+		if removed {
+			fmt.Println("  Removed OAuth 2.0 token; xpostctl falls back to OAuth 1.0a keys")
+		} else {
+			fmt.Println("  Not logged in")
+		}
+	}
+	return map[string]any{"removed": removed}, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAuthLoginAndBearerRefresh(t *testing.T) {
+	withTempCwd(t, func() {
+		fx := withFakeX(t)
+		t.Setenv("X_API_KEY", "")
+		t.Setenv("X_CLIENT_ID", "client-1")
+		prev := openBrowser
+		openBrowser = func(u string) error {
+			go func() {
+				res, err := http.Get(u)
+				if err == nil {
+					res.Body.Close()
+				}
+			}()
+			return nil
+		}
+		defer func() { openBrowser = prev }()
+
+		res, err := authCmd([]string{"login", "--port", "0"}, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := res.(map[string]any); m["refreshable"] != true {
+			t.Fatalf("login=%+v", m)
+		}
+		cfg, _ := loadConfig()
+		if c := newClient(cfg, false, true); c.oauth2 == nil {
+			t.Fatal("client does not use OAuth 2.0 after login")
+		}
+
+		tw, _ := createTweet("via bearer", nil, 0, nil)
+		if _, err := postCmd([]string{tw.ID}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		tok, _ := readJSON[*oauth2Token](oauth2Path(), nil)
+		old := tok.AccessToken
+		tok.ExpiresAt = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		_ = writeJSON(oauth2Path(), tok)
+		tw2, _ := createTweet("after refresh", nil, 0, nil)
+		if _, err := postCmd([]string{tw2.ID}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		tok, _ = readJSON[*oauth2Token](oauth2Path(), nil)
+		if tok.AccessToken == old || tok.expiresSoon(time.Now()) {
+			t.Fatalf("token not refreshed: %+v", tok)
+		}
+		if n := len(fx.Tweets()); n != 2 {
+			t.Fatalf("posted %d", n)
+		}
+
+		// Another process rotates the refresh token while this one waits for
+		// the lock; the refresh must use the rotated token, not the one read
+		// before locking. A short TTL keeps the rotated token due for refresh.
+		fx.TokenTTL = time.Second
+		tok.ExpiresAt = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		_ = writeJSON(oauth2Path(), tok)
+		release, err := acquireLock(lockPath(), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := newOAuth2App(cfg)
+		done := make(chan error, 1)
+		go func() {
+			_, err := app.accessToken()
+			done <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		rotated, err := app.exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tok.RefreshToken}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = writeJSON(oauth2Path(), rotated)
+		release()
+		if err := <-done; err != nil {
+			t.Fatalf("refresh after rotation: %v", err)
+		}
+
+		if _, err := authCmd([]string{"logout"}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		if authMode(cfg) != "oauth1" {
+			t.Fatal("still in OAuth 2.0 mode after logout")
+		}
+	})
+}
+
+func TestAuthLoginIgnoresWrongState(t *testing.T) {
+	withTempCwd(t, func() {
+		withFakeX(t)
+		t.Setenv("X_API_KEY", "")
+		t.Setenv("X_CLIENT_ID", "client-1")
+		rejected := make(chan int, 1)
+		prev := openBrowser
+		openBrowser = func(u string) error {
+			go func() {
+				authURL, _ := url.Parse(u)
+				forged := authURL.Query().Get("redirect_uri") + "?code=forged&state=wrong"
+				if res, err := http.Get(forged); err == nil {
+					res.Body.Close()
+					rejected <- res.StatusCode
+				}
+				if res, err := http.Get(u); err == nil {
+					res.Body.Close()
+				}
+			}()
+			return nil
+		}
+		defer func() { openBrowser = prev }()
+
+		if _, err := authCmd([]string{"login", "--port", "0"}, Ctx{JSON: true}); err != nil {
+			t.Fatalf("login after a wrong state: %v", err)
+		}
+		if code := <-rejected; code != http.StatusBadRequest {
+			t.Fatalf("wrong state answered %d", code)
+		}
+	})
+}
+
+func TestTokenExchangeTimesOutBeforeLockGoesStale(t *testing.T) {
+	if tokenExchangeTimeout >= lockStaleAfter {
+		t.Fatalf("token exchange timeout %s is not under the lock's %s", tokenExchangeTimeout, lockStaleAfter)
+	}
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	prev := tokenExchangeTimeout
+	tokenExchangeTimeout = 50 * time.Millisecond
+	defer func() { tokenExchangeTimeout = prev }()
+
+	start := time.Now()
+	app := oauth2App{ClientID: "client-1", TokenURL: slow.URL}
+	if _, err := app.exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"r"}}); err == nil {
+		t.Fatal("slow token endpoint did not time out")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("exchange took %s", d)
+	}
+}
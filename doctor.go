@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// doctorCheck is one line of the doctor verdict.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok, warn or fail
+	Detail string `json:"detail"`
+	Code   string `json:"code,omitempty"`
+}
+
+// credSource says where loadConfig took one credential from.
+type credSource struct {
+	Key    string `json:"key"`
+	Source string `json:"source"` // env, env file, keyring, secrets file, config or missing
+	Var    string `json:"var,omitempty"`
+	File   string `json:"file,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type fileMode struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	OK   bool   `json:"ok"`
+}
+
+type xUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// me returns the account the client's credentials belong to.
+func (c twClient) me() (xUser, error) {
+	u := c.url("/2/users/me")
+	b, err := c.send(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, c.authorize(req, nil)
+	})
+	if err != nil {
+		return xUser{}, err
+	}
+	var out struct {
+		Data xUser `json:"data"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return xUser{}, err
+	}
+	return out.Data, nil
+}
+
+// credentialSources reports, for each credential, which of the sources
+// loadConfig consults supplied it. file is the config as stored, secrets what
+// auth set saved in backend.
+func credentialSources(file Config, secrets map[string]string, backend string) []credSource {
+	out := make([]credSource, 0, len(credVars))
+	for _, v := range credVars {
+		cs := credSource{Key: v.Key, Source: "missing"}
+		if k, x := v.envOverride(); x != "" {
+			cs.Source, cs.Var, cs.Value = "env", k, maskSecret(x)
+			if p := envFileVars[k]; p != "" {
+				cs.Source, cs.File = "env file", p
+			}
+		} else if x := secrets[v.Key]; x != "" {
+			cs.Source, cs.Value = "keyring", maskSecret(x)
+			if backend == fileBackend {
+				cs.Source, cs.File = "secrets file", secretsPath()
+			}
+		} else if x := *v.field(&file); x != "" {
+			cs.Source, cs.File, cs.Value = "config", cfgPath(), maskSecret(x)
+		}
+		out = append(out, cs)
+	}
+	return out
+}
+
+// maskSecret keeps just enough of a credential to tell two apart.
+func maskSecret(s string) string {
+	if len(s) < 12 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
+
+// dataFileModes lists the data dir and the files in it with their
+// permissions; anything group- or world-accessible is flagged.
+func dataFileModes(dir string) ([]fileMode, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := []fileMode{{Path: dir, Mode: fmt.Sprintf("%04o", st.Mode().Perm()), OK: st.Mode().Perm()&0o077 == 0}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		perm := info.Mode().Perm()
+		out = append(out, fileMode{Path: filepath.Join(dir, e.Name()), Mode: fmt.Sprintf("%04o", perm), OK: perm&0o077 == 0})
+	}
+	return out, nil
+}
+
+// doctorCmd checks the environment xpostctl would post from: where the data
+// lives, where each credential comes from, whether the store is private and,
+// with --verify, whether X accepts the credentials.
+func doctorCmd(args []string, ctx Ctx) (any, error) {
+	verify := false
+	for _, a := range args {
+		switch a {
+		case "--verify":
+			verify = true
+		default:
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet doctor [--verify]", nil)
+		}
+	}
+	dir := dataDir()
+	_, dirSource := dataDirSource()
+	var checks []doctorCheck
+	check := func(name, status, detail string) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: detail})
+	}
+	// fail records a load error as a failed check so the rest of the
+	// report still runs; a locked keyring or a corrupt config is what
+	// doctor is most often asked about.
+	fail := func(name string, err error) {
+		c := doctorCheck{Name: name, Status: "fail", Detail: err.Error()}
+		if ce, ok := err.(*CliErr); ok {
+			c.Detail, c.Code = ce.Msg, ce.Code
+		}
+		checks = append(checks, c)
+	}
+
+	if f, err := os.CreateTemp(dir, ".doctor-*"); err != nil {
+		check("data dir", "fail", "not writable: "+err.Error())
+	} else {
+		f.Close()
+		os.Remove(f.Name())
+		check("data dir", "ok", dir+" ("+dirSource+")")
+	}
+
+	// The config is read, never written: doctor on a fresh data dir leaves
+	// it as it found it. Commands quietly fall back when config.json does not
+	// parse, so doctor is where that shows up.
+	if raw, err := os.ReadFile(cfgPath()); err == nil {
+		var v map[string]any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			check("config", "fail", cfgPath()+" is not valid JSON ("+err.Error()+"); commands fall back to config.json.bak or the defaults")
+		}
+	}
+	file, _, err := readConfig()
+	if err != nil {
+		fail("config", err)
+		file = defaultConfig()
+	}
+	backend := first(file.Secrets, fileBackendIfPresent())
+	secrets, err := storedSecrets(file.Secrets)
+	if err != nil {
+		fail("secrets", err)
+		secrets = map[string]string{}
+	}
+	cfg := withCredentials(file, secrets)
+
+	mode := authMode(cfg)
+	creds := credentialSources(file, secrets, backend)
+	var missing []string
+	need := func(keys ...string) {
+		for _, cs := range creds {
+			for _, k := range keys {
+				if cs.Key == k && cs.Source == "missing" {
+					missing = append(missing, k)
+				}
+			}
+		}
+	}
+	if mode == "oauth2" {
+		need("oauth2.clientId")
+		if _, err := os.Stat(oauth2Path()); err != nil {
+			missing = append(missing, "oauth2 token (run `xpostctl auth login`)")
+		}
+	} else {
+		need("twitter.apiKey", "twitter.apiSecret", "twitter.accessToken", "twitter.accessSecret")
+	}
+	if len(missing) > 0 {
+		check("credentials", "fail", mode+": missing "+strings.Join(missing, ", "))
+	} else {
+		check("credentials", "ok", mode+": all present")
+	}
+	var ignored []string
+	for _, v := range credVars {
+		if k := v.ignoredEnv(); k != "" {
+			ignored = append(ignored, k+" (use "+profileEnv(currentProfile(), k)+")")
+		}
+	}
+	if len(ignored) > 0 {
+		check("env", "warn", "profile "+currentProfile()+" ignores "+strings.Join(ignored, ", ")+"; global X credentials only apply to the default profile")
+	}
+
+	var plain []string
+	for _, v := range credVars {
+		if *v.field(&file) != "" {
+			plain = append(plain, v.Key)
+		}
+	}
+	if len(plain) > 0 {
+		check("plaintext", "warn", "config.json holds "+strings.Join(plain, ", ")+"; move them with `xpostctl auth set --import`")
+	}
+	for _, bak := range configBackups() {
+		if keys := plaintextCreds(bak); len(keys) > 0 {
+			check("plaintext", "warn", filepath.Base(bak)+" holds "+strings.Join(keys, ", ")+"; `xpostctl auth set --import` scrubs it, or delete the file")
+		}
+	}
+
+	files, err := dataFileModes(dir)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "windows" {
+		check("permissions", "ok", "not checked on Windows")
+	} else {
+		var open []string
+		for _, f := range files {
+			if !f.OK {
+				open = append(open, filepath.Base(f.Path)+" "+f.Mode)
+			}
+		}
+		if len(open) > 0 {
+			check("permissions", "warn", "readable by others: "+strings.Join(open, ", ")+"; chmod 700 the dir and 600 the files")
+		} else {
+			check("permissions", "ok", "private to the owner")
+		}
+	}
+
+	var user *xUser
+	if verify {
+		c := newClient(cfg, false, true)
+		u, err := c.me()
+		if err != nil {
+			ce := apiFail("VERIFY_FAILED", "X rejected the request: "+err.Error(), err, map[string]any{}).(*CliErr)
+			checks = append(checks, doctorCheck{Name: "verify", Status: "fail", Detail: ce.Msg, Code: ce.Code})
+		} else {
+			user = &u
+			_ = c.saveAccount(u)
+			check("verify", "ok", "authenticated as @"+u.Username)
+		}
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if c.Status == "fail" {
+			failed++
+		}
+	}
+	report := map[string]any{
+		"ok":          failed == 0,
+		"profile":     currentProfile(),
+		"dataDir":     dir,
+		"dataDirFrom": dirSource,
+		"config":      cfgPath(),
+		"store":       storeBackend(),
+		"auth":        mode,
+		"apiBase":     apiBase(cfg),
+		"credentials": creds,
+		"files":       files,
+		"checks":      checks,
+	}
+	if user != nil {
+		report["user"] = user
+	}
+	if !ctx.JSON {
+		printDoctor(report, creds, checks, user)
+	}
+	if failed > 0 {
+		return nil, cliFail("DOCTOR_FAILED", fmt.Sprintf("%d check(s) failed", failed), report)
+	}
+	return report, nil
+}
+
+func printDoctor(report map[string]any, creds []credSource, checks []doctorCheck, user *xUser) {
+	fmt.Printf("\n  profile: %s\n  data dir: %s (%s)\n", report["profile"], report["dataDir"], report["dataDirFrom"])
+	fmt.Printf("  store: %s\n  auth: %s via %s\n", report["store"], report["auth"], report["apiBase"])
+	if user != nil {
+		fmt.Printf("  account: @%s (%s, id %s)\n", user.Username, user.Name, user.ID)
+	}
+	fmt.Println("\n  credentials:")
+	for _, cs := range creds {
+		from := cs.Source
+		switch cs.Source {
+		case "env":
+			from = "env " + cs.Var
+		case "env file":
+			from = cs.Var + " from " + cs.File
+		case "config":
+			from = "config.json (plaintext)"
+		case "secrets file":
+			from = "secrets.enc"
+		}
+		fmt.Printf("    %-22s %s\n", cs.Key, from)
+	}
+	fmt.Println()
+	for _, c := range checks {
+		fmt.Printf("  %-5s %s: %s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+	}
+	fmt.Println()
+}
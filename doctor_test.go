@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDoctorReportsSourcesAndVerifies(t *testing.T) {
+	withTempCwd(t, func() {
+		withFakeX(t)
+		t.Setenv("XPOSTCTL_AUTH", "oauth1")
+		t.Setenv("X_ACCESS_TOKEN", "")
+		t.Setenv("X_ACCESS_SECRET", "")
+		t.Cleanup(func() { envFileVars = map[string]string{} })
+		if err := os.WriteFile("x.env", []byte("X_ACCESS_TOKEN=at\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfgPath(), []byte(`{"twitter":{"accessSecret":"as"}}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfgPath()+".bak", []byte(`{"twitter":{"apiSecret":"old"}}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := doctorCmd([]string{"--verify"}, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := res.(map[string]any)
+		if r["dataDirFrom"] != "env" || r["auth"] != "oauth1" {
+			t.Fatalf("report=%v", r)
+		}
+		want := map[string]string{"twitter.apiKey": "env", "twitter.accessToken": "env file", "twitter.accessSecret": "config", "oauth2.clientId": "missing"}
+		for _, cs := range r["credentials"].([]credSource) {
+			if w, ok := want[cs.Key]; ok && cs.Source != w {
+				t.Fatalf("%s from %s, want %s", cs.Key, cs.Source, w)
+			}
+		}
+		if u := r["user"].(*xUser); u.Username != "fakeuser" {
+			t.Fatalf("user=%+v", u)
+		}
+		perms, backup := "", false
+		for _, c := range r["checks"].([]doctorCheck) {
+			if c.Name == "permissions" {
+				perms = c.Status
+			}
+			backup = backup || (c.Name == "plaintext" && strings.Contains(c.Detail, "config.json.bak holds twitter.apiSecret"))
+		}
+		if !backup {
+			t.Fatalf("checks=%+v, want a plaintext warning for config.json.bak", r["checks"])
+		}
+		if runtime.GOOS != "windows" && perms != "warn" {
+			t.Fatalf("permissions=%q, want warn for a 0644 config", perms)
+		}
+
+		t.Setenv("X_ACCESS_SECRET", "wrong")
+		_, err = doctorCmd([]string{"--verify"}, Ctx{JSON: true})
+		ce, ok := err.(*CliErr)
+		if !ok || ce.Code != "DOCTOR_FAILED" {
+			t.Fatalf("err=%v", err)
+		}
+		for _, c := range ce.Details.(map[string]any)["checks"].([]doctorCheck) {
+			if c.Name == "verify" && c.Code != "UNAUTHORIZED" {
+				t.Fatalf("verify=%+v", c)
+			}
+		}
+	})
+}
+
+func TestDoctorFlagsMissingCredentials(t *testing.T) {
+	withTempCwd(t, func() {
+		for _, v := range credVars {
+			for _, k := range v.Env {
+				t.Setenv(k, "")
+			}
+		}
+		t.Setenv("XPOSTCTL_AUTH", "")
+		_, err := doctorCmd(nil, Ctx{JSON: true})
+		ce, ok := err.(*CliErr)
+		if !ok || ce.Code != "DOCTOR_FAILED" {
+			t.Fatalf("err=%v", err)
+		}
+		files := ce.Details.(map[string]any)["files"].([]fileMode)
+		if len(files) == 0 || files[0].Path != filepath.Clean(dataDir()) {
+			t.Fatalf("files=%+v", files)
+		}
+		if _, err := os.Stat(cfgPath()); !os.IsNotExist(err) {
+			t.Fatalf("doctor created config.json: %v", err)
+		}
+	})
+}
+
+func TestDoctorReportsLoadFailures(t *testing.T) {
+	withTempCwd(t, func() {
+		clearCredEnv(t)
+		prev := pbkdf2Iterations
+		pbkdf2Iterations = 1000
+		t.Cleanup(func() { pbkdf2Iterations = prev })
+		t.Setenv("XPOSTCTL_PASSPHRASE", "correct horse")
+		if _, err := authSetCmd([]string{"apiKey", "key-123"}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Remove(cfgPath() + ".bak")
+		if err := os.WriteFile(cfgPath(), []byte(`{"store": "json",`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("XPOSTCTL_PASSPHRASE", "wrong")
+
+		_, err := doctorCmd(nil, Ctx{JSON: true})
+		ce, ok := err.(*CliErr)
+		if !ok || ce.Code != "DOCTOR_FAILED" {
+			t.Fatalf("err=%v", err)
+		}
+		got := map[string]string{}
+		for _, c := range ce.Details.(map[string]any)["checks"].([]doctorCheck) {
+			if c.Status == "fail" {
+				got[c.Name] = first(c.Code, "error")
+			}
+		}
+		if got["config"] == "" || got["secrets"] != "SECRETS_LOCKED" || got["credentials"] == "" {
+			t.Fatalf("failed checks=%v", got)
+		}
+	})
+}
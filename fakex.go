@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fakeX is an in-memory stand-in for the parts of the X API xpostctl uses:
+// posting, replies, deletes, chunked media upload, alt text and the OAuth 2.0
+// PKCE login. It checks OAuth 1.0a signatures against its own credentials and
+// Bearer tokens against the ones it issued, so a client with the wrong keys
+// fails the way it would against X. Tests mount it on httptest;
+// `xpostctl dev fake-server` serves it on a port.
+type fakeX struct {
+	mu     sync.Mutex
+	creds  oauthCreds
+	seq    int
+	tweets []fakeTweet
+	media  map[string]*fakeMedia
+	fails  []fakeFailure
+	// OAuth 2.0 state: pending authorization codes, and issued access and
+	// refresh tokens. TokenTTL is how long access tokens live.
+	codes    map[string]fakeGrant
+	bearers  map[string]time.Time
+	refresh  map[string]bool
+	TokenTTL time.Duration
+}
+
+type fakeGrant struct{ clientID, redirect, challenge string }
+
+type fakeTweet struct {
+	ID       string   `json:"id"`
+	Text     string   `json:"text"`
+	ReplyTo  string   `json:"in_reply_to_tweet_id,omitempty"`
+	MediaIDs []string `json:"media_ids,omitempty"`
+	Deleted  bool     `json:"deleted,omitempty"`
+}
+
+type fakeMedia struct {
+	ID        string `json:"id"`
+	Type      string `json:"media_type"`
+	Total     int64  `json:"total_bytes"`
+	Received  int64  `json:"received_bytes"`
+	Finalized bool   `json:"finalized"`
+	Alt       string `json:"alt,omitempty"`
+}
+
+// fakeFailure makes the next Count requests whose path starts with Path fail
+// after authentication. Kind is an HTTP status ("429", "503") or "duplicate".
+type fakeFailure struct {
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+	Path  string `json:"path,omitempty"`
+}
+
+func newFakeX(creds oauthCreds) *fakeX {
+	return &fakeX{creds: creds, media: map[string]*fakeMedia{}, codes: map[string]fakeGrant{}, bearers: map[string]time.Time{}, refresh: map[string]bool{}, TokenTTL: 2 * time.Hour}
+}
+
+// parseFakeFailure reads kind[:count][@path], e.g. "429:2" or
+// "503@/2/media/upload".
+func parseFakeFailure(s string) (fakeFailure, error) {
+	f := fakeFailure{Count: 1}
+	if i := strings.Index(s, "@"); i >= 0 {
+		s, f.Path = s[:i], s[i+1:]
+	}
+	if i := strings.Index(s, ":"); i >= 0 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("invalid failure count in %q", s)
+		}
+		s, f.Count = s[:i], n
+	}
+	f.Kind = s
+	if n, err := strconv.Atoi(s); f.Kind != "duplicate" && (err != nil || n < 400 || n > 599) {
+		return f, fmt.Errorf("failure kind must be an HTTP status 400-599 or \"duplicate\", got %q", s)
+	}
+	return f, nil
+}
+
+func (f *fakeX) Fail(ff fakeFailure) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fails = append(f.fails, ff)
+}
+
+// Tweets returns everything posted so far, deleted tweets included.
+func (f *fakeX) Tweets() []fakeTweet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeTweet(nil), f.tweets...)
+}
+
+func (f *fakeX) nextID() string {
+	f.seq++
+	return strconv.FormatInt(1900000000000000000+int64(f.seq), 10)
+}
+
+func fakeProblem(w http.ResponseWriter, status int, title, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"title": title, "detail": detail, "type": "about:blank", "status": status})
+}
+
+func fakeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func (f *fakeX) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	switch r.URL.Path {
+	case "/i/oauth2/authorize":
+		f.authorizeOAuth2(w, r)
+		return
+	case "/2/oauth2/token":
+		f.token(w, r, body)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/_fake/") {
+		f.control(w, r, body)
+		return
+	}
+	if err := f.verify(r, body); err != nil {
+		fakeProblem(w, http.StatusUnauthorized, "Unauthorized", err.Error())
+		return
+	}
+	if f.injectFailure(w, r.URL.Path) {
+		return
+	}
+	switch path := r.URL.Path; {
+	case path == "/2/tweets" && r.Method == http.MethodPost:
+		f.createTweet(w, body)
+	case strings.HasPrefix(path, "/2/tweets/") && (r.Method == http.MethodDelete || r.Method == http.MethodGet):
+		f.tweetByID(w, r.Method, strings.TrimPrefix(path, "/2/tweets/"))
+	case path == "/2/users/me" && r.Method == http.MethodGet:
+		fakeData(w, http.StatusOK, map[string]string{"id": "1", "name": "Fake User", "username": "fakeuser"})
+	case path == mediaUploadPath:
+		f.upload(w, r, body)
+	case path == mediaMetadataPath && r.Method == http.MethodPost:
+		f.metadata(w, body)
+	default:
+		fakeProblem(w, http.StatusNotFound, "Not Found", r.Method+" "+path+" is not implemented by the fake server")
+	}
+}
+
+// verify accepts a live Bearer token it issued, or recomputes the OAuth
+// 1.0a signature the way X does: query and urlencoded form parameters are
+// signed, JSON and multipart bodies are not.
+func (f *fakeX) verify(r *http.Request, body []byte) error {
+	h := r.Header.Get("Authorization")
+	if tok, ok := strings.CutPrefix(h, "Bearer "); ok {
+		if exp, ok := f.bearers[tok]; !ok || time.Now().After(exp) {
+			return errors.New("invalid or expired access token")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(h, "OAuth ") {
+		return errors.New("missing OAuth Authorization header")
+	}
+	got := parseOAuthHeader(h)
+	if got["oauth_consumer_key"] != f.creds.APIKey || got["oauth_token"] != f.creds.AccessToken {
+		return errors.New("unknown consumer key or access token")
+	}
+	params := map[string]string{}
+	for k, v := range r.URL.Query() {
+		params[k] = v[0]
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "application/x-www-form-urlencoded" {
+		form, _ := url.ParseQuery(string(body))
+		for k, v := range form {
+			params[k] = v[0]
+		}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	want := parseOAuthHeader(sign(r.Method, scheme+"://"+r.Host+r.URL.Path, f.creds, params, got["oauth_nonce"], got["oauth_timestamp"]))
+	if got["oauth_signature"] == "" || got["oauth_signature"] != want["oauth_signature"] {
+		return errors.New("invalid OAuth signature")
+	}
+	return nil
+}
+
+func parseOAuthHeader(h string) map[string]string {
+	out := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(h, "OAuth "), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		v, _ = url.QueryUnescape(strings.Trim(v, `"`))
+		out[k] = v
+	}
+	return out
+}
+
+func (f *fakeX) injectFailure(w http.ResponseWriter, path string) bool {
+	for i := range f.fails {
+		ff := &f.fails[i]
+		if ff.Count <= 0 || !strings.HasPrefix(path, ff.Path) {
+			continue
+		}
+		ff.Count--
+		switch ff.Kind {
+		case "duplicate":
+			fakeProblem(w, http.StatusForbidden, "Forbidden", "You are not allowed to create a Tweet with duplicate content.")
+		case "429":
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10))
+			fakeProblem(w, http.StatusTooManyRequests, "Too Many Requests", "Too Many Requests")
+		default:
+			status, _ := strconv.Atoi(ff.Kind)
+			fakeProblem(w, status, http.StatusText(status), "injected failure")
+		}
+		return true
+	}
+	return false
+}
+
+func (f *fakeX) createTweet(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Text  string `json:"text"`
+		Reply *struct {
+			InReplyTo string `json:"in_reply_to_tweet_id"`
+		} `json:"reply"`
+		Media *struct {
+			IDs []string `json:"media_ids"`
+		} `json:"media"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		fakeProblem(w, http.StatusBadRequest, "Invalid Request", "body is not valid JSON")
+		return
+	}
+	t := fakeTweet{Text: req.Text}
+	if req.Media != nil {
+		t.MediaIDs = req.Media.IDs
+	}
+	if strings.TrimSpace(t.Text) == "" && len(t.MediaIDs) == 0 {
+		fakeProblem(w, http.StatusBadRequest, "Invalid Request", "One or more parameters to your request was invalid.")
+		return
+	}
+	if weightedLength(t.Text) > maxTweetLength {
+		fakeProblem(w, http.StatusForbidden, "Forbidden", "Your Tweet text is too long.")
+		return
+	}
+	for _, old := range f.tweets {
+		if !old.Deleted && old.Text == t.Text && t.Text != "" {
+			fakeProblem(w, http.StatusForbidden, "Forbidden", "You are not allowed to create a Tweet with duplicate content.")
+			return
+		}
+	}
+	if req.Reply != nil {
+		t.ReplyTo = req.Reply.InReplyTo
+		if _, ok := f.find(t.ReplyTo); !ok {
+			fakeProblem(w, http.StatusBadRequest, "Invalid Request", "The Tweet being replied to does not exist: "+t.ReplyTo)
+			return
+		}
+	}
+	for _, id := range t.MediaIDs {
+		if m := f.media[id]; m == nil || !m.Finalized {
+			fakeProblem(w, http.StatusBadRequest, "Invalid Request", "Media id is not uploaded or not finalized: "+id)
+			return
+		}
+	}
+	t.ID = f.nextID()
+	f.tweets = append(f.tweets, t)
+	fakeData(w, http.StatusCreated, map[string]string{"id": t.ID, "text": t.Text})
+}
+
+func (f *fakeX) find(id string) (int, bool) {
+	for i, t := range f.tweets {
+		if t.ID == id && !t.Deleted {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (f *fakeX) tweetByID(w http.ResponseWriter, method, id string) {
+	i, ok := f.find(id)
+	if !ok {
+		fakeProblem(w, http.StatusNotFound, "Not Found Error", "Could not find tweet with id: ["+id+"].")
+		return
+	}
+	if method == http.MethodDelete {
+		f.tweets[i].Deleted = true
+		fakeData(w, http.StatusOK, map[string]bool{"deleted": true})
+		return
+	}
+	fakeData(w, http.StatusOK, map[string]string{"id": id, "text": f.tweets[i].Text})
+}
+
+func (f *fakeX) upload(w http.ResponseWriter, r *http.Request, body []byte) {
+	fields := url.Values{}
+	var chunk []byte
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case r.Method == http.MethodGet:
+		fields = r.URL.Query()
+	case ct == "application/x-www-form-urlencoded":
+		fields, _ = url.ParseQuery(string(body))
+	case ct == "multipart/form-data":
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := r.ParseMultipartForm(64 << 20); err != nil {
+			fakeProblem(w, http.StatusBadRequest, "Invalid Request", err.Error())
+			return
+		}
+		fields = url.Values(r.MultipartForm.Value)
+		if fh := r.MultipartForm.File["media"]; len(fh) > 0 {
+			fr, _ := fh[0].Open()
+			chunk, _ = io.ReadAll(fr)
+			fr.Close()
+		}
+	}
+	cmd := fields.Get("command")
+	if cmd == "INIT" {
+		total, _ := strconv.ParseInt(fields.Get("total_bytes"), 10, 64)
+		m := &fakeMedia{ID: f.nextID(), Type: fields.Get("media_type"), Total: total}
+		f.media[m.ID] = m
+		fakeData(w, http.StatusAccepted, map[string]any{"id": m.ID, "media_key": "3_" + m.ID})
+		return
+	}
+	m := f.media[fields.Get("media_id")]
+	if m == nil {
+		fakeProblem(w, http.StatusBadRequest, "Invalid Request", "unknown media_id: "+fields.Get("media_id"))
+		return
+	}
+	switch cmd {
+	case "APPEND":
+		m.Received += int64(len(chunk))
+		w.WriteHeader(http.StatusNoContent)
+	case "FINALIZE":
+		if m.Received != m.Total {
+			fakeProblem(w, http.StatusBadRequest, "Invalid Request", fmt.Sprintf("received %d of %d bytes", m.Received, m.Total))
+			return
+		}
+		m.Finalized = true
+		fakeData(w, http.StatusOK, map[string]any{"id": m.ID, "processing_info": map[string]string{"state": "succeeded"}})
+	case "STATUS":
+		fakeData(w, http.StatusOK, map[string]any{"id": m.ID, "processing_info": map[string]string{"state": "succeeded"}})
+	default:
+		fakeProblem(w, http.StatusBadRequest, "Invalid Request", "unknown command: "+cmd)
+	}
+}
+
+func (f *fakeX) metadata(w http.ResponseWriter, body []byte) {
+	var req struct {
+		ID       string `json:"id"`
+		Metadata struct {
+			AltText struct {
+				Text string `json:"text"`
+			} `json:"alt_text"`
+		} `json:"metadata"`
+	}
+	_ = json.Unmarshal(body, &req)
+	m := f.media[req.ID]
+	if m == nil {
+		fakeProblem(w, http.StatusBadRequest, "Invalid Request", "unknown media id: "+req.ID)
+		return
+	}
+	m.Alt = req.Metadata.AltText.Text
+	fakeData(w, http.StatusOK, map[string]any{"id": m.ID, "associated_metadata": true})
+}
+
+// authorizeOAuth2 approves every request at once, as if the user clicked
+// "Authorize app", and redirects back with a code bound to the PKCE challenge.
+func (f *fakeX) authorizeOAuth2(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") == "" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		fakeProblem(w, http.StatusBadRequest, "Invalid Request", "authorize needs response_type=code, client_id and an S256 code_challenge")
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		fakeProblem(w, http.StatusBadRequest, "Invalid Request", "invalid redirect_uri")
+		return
+	}
+	code := randomURLSafe(16)
+	f.codes[code] = fakeGrant{clientID: q.Get("client_id"), redirect: q.Get("redirect_uri"), challenge: q.Get("code_challenge")}
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (f *fakeX) token(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	switch form.Get("grant_type") {
+	case "authorization_code":
+		g, ok := f.codes[form.Get("code")]
+		delete(f.codes, form.Get("code"))
+		if !ok || g.clientID != form.Get("client_id") || g.redirect != form.Get("redirect_uri") || pkceChallenge(form.Get("code_verifier")) != g.challenge {
+			fakeProblem(w, http.StatusBadRequest, "invalid_request", "Value passed for the authorization code was invalid.")
+			return
+		}
+	case "refresh_token":
+		if !f.refresh[form.Get("refresh_token")] {
+			fakeProblem(w, http.StatusBadRequest, "invalid_request", "Value passed for the token was invalid.")
+			return
+		}
+		delete(f.refresh, form.Get("refresh_token"))
+	default:
+		fakeProblem(w, http.StatusBadRequest, "invalid_request", "unsupported grant_type")
+		return
+	}
+	access, refresh := randomURLSafe(24), randomURLSafe(24)
+	f.bearers[access] = time.Now().Add(f.TokenTTL)
+	f.refresh[refresh] = true
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"token_type": "bearer", "access_token": access, "refresh_token": refresh, "expires_in": int(f.TokenTTL.Seconds()), "scope": oauth2Scopes})
+}
+
+// control serves the unauthenticated /_fake/ endpoints used to inspect the
+// server and inject failures from outside the process.
+func (f *fakeX) control(w http.ResponseWriter, r *http.Request, body []byte) {
+	switch r.URL.Path {
+	case "/_fake/tweets":
+		fakeData(w, http.StatusOK, f.tweets)
+	case "/_fake/media":
+		fakeData(w, http.StatusOK, f.media)
+	case "/_fake/fail":
+		ff, err := parseFakeFailure(first(r.URL.Query().Get("spec"), strings.TrimSpace(string(body))))
+		if err != nil {
+			fakeProblem(w, http.StatusBadRequest, "Invalid Request", err.Error())
+			return
+		}
+		f.fails = append(f.fails, ff)
+		fakeData(w, http.StatusOK, f.fails)
+	case "/_fake/reset":
+		f.tweets, f.media, f.fails = nil, map[string]*fakeMedia{}, nil
+		f.codes, f.bearers, f.refresh = map[string]fakeGrant{}, map[string]time.Time{}, map[string]bool{}
+		fakeData(w, http.StatusOK, map[string]bool{"reset": true})
+	default:
+		fakeProblem(w, http.StatusNotFound, "Not Found", "unknown control endpoint")
+	}
+}
+
+func devCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) == 0 || args[0] != "fake-server" {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet dev fake-server [--addr 127.0.0.1:8787] [--fail <status|duplicate>[:count][@path]]...", nil)
+	}
+	return fakeServerCmd(args[1:], ctx)
+}
+
+// fakeServerCmd serves fakeX until interrupted. It accepts the credentials
+// xpostctl itself would sign with, falling back to fixed fake ones.
+func fakeServerCmd(args []string, ctx Ctx) (any, error) {
+	addr := "127.0.0.1:8787"
+	fails := []fakeFailure{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--addr" && i+1 < len(args):
+			addr = args[i+1]
+			i++
+		case args[i] == "--fail" && i+1 < len(args):
+			ff, err := parseFakeFailure(args[i+1])
+			if err != nil {
+				return nil, cliFail("INVALID_ARGS", err.Error(), nil)
+			}
+			fails = append(fails, ff)
+			i++
+		default:
+			return nil, cliFail("INVALID_ARGS", "Unknown flag: "+args[i], nil)
+		}
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	creds := newClient(cfg, false, true).creds
+	if creds.APIKey == "" || creds.AccessToken == "" {
+		creds = oauthCreds{APIKey: "fake-key", APISecret: "fake-secret", AccessToken: "fake-token", AccessSecret: "fake-token-secret"}
+	}
+	fx := newFakeX(creds)
+	fx.fails = fails
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: fx, ReadHeaderTimeout: 10 * time.Second}
+	base := "http://" + ln.Addr().String()
+	if !ctx.JSON {
+		fmt.Println("  Fake X API listening on", base)
+		fmt.Printf("  Point xpostctl at it:  XPOSTCTL_API_BASE=%s\n", base)
+		if creds.APIKey == "fake-key" {
+			fmt.Println("  No credentials configured; it accepts X_API_KEY=fake-key X_API_SECRET=fake-secret X_ACCESS_TOKEN=fake-token X_ACCESS_SECRET=fake-token-secret")
+		}
+		fmt.Println("  Inspect: GET /_fake/tweets   Inject: POST /_fake/fail?spec=429:2   Ctrl-C to stop")
+	}
+	sig, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	select {
+	case <-sig.Done():
+		shut, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shut)
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return nil, err
+		}
+	}
+	return map[string]any{"addr": base, "tweets": fx.Tweets()}, nil
+}
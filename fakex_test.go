@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withFakeX points the CLI at a fake X server for the duration of the test.
+func withFakeX(t *testing.T) *fakeX {
+	creds := oauthCreds{APIKey: "ck", APISecret: "cs", AccessToken: "at", AccessSecret: "as"}
+	fx := newFakeX(creds)
+	srv := httptest.NewServer(fx)
+	t.Cleanup(srv.Close)
+	t.Setenv("XPOSTCTL_API_BASE", srv.URL)
+	t.Setenv("X_API_KEY", creds.APIKey)
+	t.Setenv("X_API_SECRET", creds.APISecret)
+	t.Setenv("X_ACCESS_TOKEN", creds.AccessToken)
+	t.Setenv("X_ACCESS_SECRET", creds.AccessSecret)
+	prevSleep, prevDelay := sleep, threadPostDelay
+	sleep, threadPostDelay = func(time.Duration) {}, 0
+	t.Cleanup(func() { sleep, threadPostDelay = prevSleep, prevDelay })
+	return fx
+}
+
+func TestPostAgainstFakeX(t *testing.T) {
+	withTempCwd(t, func() {
+		fx := withFakeX(t)
+		ctx := Ctx{JSON: true}
+		img := filepath.Join(t.TempDir(), "chart.png")
+		if err := os.WriteFile(img, make([]byte, 1000), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		res, err := threadCmd([]string{"new", "first", "--media", img, "--alt", "a chart"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tid := res.(map[string]any)["threadId"].(string)
+		if _, err := threadCmd([]string{"add", tid, "second"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		fx.Fail(fakeFailure{Kind: "503", Count: 1, Path: "/2/tweets"})
+		fx.Fail(fakeFailure{Kind: "429", Count: 1, Path: "/2/tweets"})
+		members, _ := threadTweets(tid)
+		if _, err := postCmd([]string{members[1].ID}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		got := fx.Tweets()
+		if len(got) != 2 || got[0].Text != "first" || len(got[0].MediaIDs) != 1 || got[1].ReplyTo != got[0].ID {
+			t.Fatalf("fake tweets=%+v", got)
+		}
+		if m := fx.media[got[0].MediaIDs[0]]; m.Alt != "a chart" || m.Received != 1000 {
+			t.Fatalf("media=%+v", m)
+		}
+
+		dup, _ := createTweet("first", nil, 0, nil)
+		if _, err := postCmd([]string{dup.ID}, ctx); err == nil || err.(*CliErr).Code != "DUPLICATE" {
+			t.Fatalf("err=%v", err)
+		}
+		if tw, _ := getTweet(dup.ID); tw.Status != failedStatus || tw.Attempts[0].HTTPStatus != 403 {
+			t.Fatalf("tweet=%+v", tw)
+		}
+
+		if _, err := deleteCmd([]string{members[1].ID}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if !fx.Tweets()[1].Deleted {
+			t.Fatal("remote tweet not deleted")
+		}
+
+		t.Setenv("X_ACCESS_SECRET", "wrong")
+		other, _ := createTweet("other", nil, 0, nil)
+		if _, err := postCmd([]string{other.ID}, ctx); err == nil || err.(*CliErr).Code != "UNAUTHORIZED" {
+			t.Fatalf("bad signature accepted: %v", err)
+		}
+	})
+}
+
+func TestParseFakeFailure(t *testing.T) {
+	f, err := parseFakeFailure("429:3@/2/tweets")
+	if err != nil || f.Kind != "429" || f.Count != 3 || f.Path != "/2/tweets" {
+		t.Fatalf("f=%+v err=%v", f, err)
+	}
+	for _, bad := range []string{"200", "boom", "503:0"} {
+		if _, err := parseFakeFailure(bad); err == nil {
+			t.Fatalf("%s accepted", bad)
+		}
+	}
+}
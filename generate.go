@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// genRequest is one generation: Mode is single, thread or ideas. Topics
+// are what ideas draw from.
+type genRequest struct {
+	Mode   string
+	Topic  string
+	Topics []string
+	System string
+	Prompt string
+	// Variant numbers the candidates of generate --variants from 0.
+	Variant int
+}
+
+// Generator writes tweet text for a prompt. Name is recorded on the
+// generation as its model.
+type Generator interface {
+	Name() string
+	Generate(req genRequest) (string, error)
+}
+
+const (
+	templateProvider = "template"
+	openAIProvider   = "openai"
+	ollamaProvider   = "ollama"
+
+	defaultOpenAIBase  = "https://api.openai.com/v1"
+	defaultOpenAIModel = "gpt-4o-mini"
+	defaultOllamaBase  = "http://localhost:11434/v1"
+	defaultOllamaModel = "llama3.2"
+)
+
+var aiProviders = []string{templateProvider, openAIProvider, ollamaProvider}
+
+// aiHTTPClient is separate from xHTTPClient because a local model can take
+// far longer than the X API to answer.
+var aiHTTPClient = &http.Client{Timeout: 3 * time.Minute}
+
+// newGenerator picks the provider from XPOSTCTL_AI_PROVIDER or config
+// ai.provider. Without one, generation stays offline with the templates.
+func newGenerator(cfg Config) (Generator, error) {
+	provider := strings.ToLower(first(strings.TrimSpace(os.Getenv("XPOSTCTL_AI_PROVIDER")), cfg.AI.Provider, templateProvider))
+	model := first(strings.TrimSpace(os.Getenv("XPOSTCTL_AI_MODEL")), cfg.AI.Model)
+	base := first(strings.TrimSpace(os.Getenv("XPOSTCTL_AI_BASE_URL")), cfg.AI.BaseURL)
+	switch provider {
+	case templateProvider:
+		return templateGenerator{}, nil
+	case openAIProvider:
+		g := openAIGenerator{BaseURL: first(base, defaultOpenAIBase), APIKey: cfg.AI.APIKey, Model: first(model, defaultOpenAIModel), Temperature: cfg.AI.Temperature}
+		if g.APIKey == "" && g.BaseURL == defaultOpenAIBase {
+			return nil, cliFail("INVALID_CONFIG", "No AI API key; set OPENAI_API_KEY or run `xpostctl auth set ai.apiKey`", map[string]any{"provider": provider})
+		}
+		return g, nil
+	case ollamaProvider:
+		return openAIGenerator{BaseURL: first(base, defaultOllamaBase), APIKey: cfg.AI.APIKey, Model: first(model, defaultOllamaModel), Temperature: cfg.AI.Temperature}, nil
+	default:
+		return nil, cliFail("INVALID_CONFIG", "Unknown AI provider: "+provider, map[string]any{"available": aiProviders})
+	}
+}
+
+// templateGenerator is the offline fallback: canned text around the topic.
+type templateGenerator struct{}
+
+func (templateGenerator) Name() string { return templateProvider }
+
+func (templateGenerator) Generate(r genRequest) (string, error) {
+	if r.Mode == "ideas" {
+		return templateIdeas(r.Topics), nil
+	}
+	return genTemplate(r.Mode, r.Topic, r.Variant), nil
+}
+
+var ideaShapes = []string{
+	"Share one unpopular %s tradeoff you changed your mind on.",
+	"A small %s automation that saves your team 30 minutes daily.",
+	"Why most %s dashboards hide the metric that matters.",
+	"[THREAD] A real %s incident timeline and what you fixed first.",
+	"A %s code review habit that reduced bugs in your team.",
+	"How you scope %s features to fit one sprint.",
+	"[THREAD] Lessons from replacing a legacy %s dependency.",
+	"A practical %s workflow that actually helps coding speed.",
+	"One %s configuration most teams forget.",
+	"What you would delete from your %s stack today and why.",
+}
+
+// templateIdeas fills the idea shapes with topics in turn.
+func templateIdeas(topics []string) string {
+	if len(topics) == 0 {
+		topics = []string{"engineering"}
+	}
+	lines := make([]string, len(ideaShapes))
+	for i, shape := range ideaShapes {
+		lines[i] = fmt.Sprintf("%d. "+shape, i+1, topics[i%len(topics)])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// singleShapes are the offline single tweets; variants take them in turn.
+var singleShapes = []string{
+	"Most wins in %s come from reducing cycle time, not adding complexity. Short feedback loops beat perfect architecture.",
+	"The best %s change I made this year was deleting code, not adding it. Fewer moving parts, fewer 2am pages.",
+	"If your %s setup needs a wiki page to explain, it is too clever. Boring and obvious ships faster.",
+	"Measure %s before you optimize it. Half the slow paths I have chased were never on the hot path.",
+	"Hot take: %s problems are usually feedback problems. Make the loop shorter and the fix gets obvious.",
+}
+
+func genTemplate(mode, topic string, variant int) string {
+	switch mode {
+	case "ideas":
+		return templateIdeas([]string{topic})
+	case "thread":
+		return fmt.Sprintf("Most teams overcomplicate %s. Here is the lean approach that ships.\n---\n1) Set a single success metric before writing code.\n---\n2) Build the smallest path to prove the metric in prod.\n---\n3) Remove abstractions until pain appears, then add one layer.\n---\n4) Document tradeoffs and revisit in two weeks with real data.", topic)
+	default:
+		msg := fmt.Sprintf(singleShapes[variant%len(singleShapes)], topic)
+		return truncateWeighted(msg, maxTweetLength)
+	}
+}
+
+// openAIGenerator talks to any OpenAI-compatible chat completions API:
+// OpenAI itself, or a local Ollama / llama.cpp server via BaseURL.
+type openAIGenerator struct {
+	BaseURL     string
+	APIKey      string
+	Model       string
+	Temperature *float64
+}
+
+func (g openAIGenerator) Name() string { return g.Model }
+
+func (g openAIGenerator) Generate(r genRequest) (string, error) {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	body := map[string]any{"model": g.Model, "messages": []message{{"system", r.System}, {"user", r.Prompt}}}
+	if g.Temperature != nil {
+		body["temperature"] = *g.Temperature
+	}
+	raw, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(g.BaseURL, "/")+"/chat/completions", bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.APIKey)
+	}
+	res, err := aiHTTPClient.Do(req)
+	if err != nil {
+		return "", cliFail("GENERATE_FAILED", "AI provider unreachable: "+err.Error(), map[string]any{"baseUrl": g.BaseURL, "hint": "use --offline for the built-in templates"})
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	var out struct {
+		Choices []struct {
+			Message message `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(b, &out)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(b))
+		if out.Error != nil && out.Error.Message != "" {
+			msg = out.Error.Message
+		}
+		return "", cliFail("GENERATE_FAILED", fmt.Sprintf("AI provider error %d: %s", res.StatusCode, msg), map[string]any{"status": res.StatusCode, "model": g.Model})
+	}
+	if len(out.Choices) == 0 || strings.TrimSpace(out.Choices[0].Message.Content) == "" {
+		return "", cliFail("GENERATE_FAILED", "AI provider returned no text", map[string]any{"model": g.Model})
+	}
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
+
+var threadSeparator = regexp.MustCompile(`(?m)^[ \t]*-{3,}[ \t]*$`)
+
+// threadParts splits generated thread text on --- lines, dropping empty
+// parts.
+func threadParts(raw string) []string {
+	var out []string
+	for _, p := range threadSeparator.Split(raw, -1) {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// cleanSingle removes the quotes models like to wrap a lone tweet in.
+func cleanSingle(s string) string {
+	s = strings.TrimSpace(s)
+	if u, err := strconv.Unquote(s); err == nil && strings.HasPrefix(s, `"`) {
+		return strings.TrimSpace(u)
+	}
+	return strings.Trim(s, "“”")
+}
+
+// avoidHits returns the phrases of avoid that text contains, ignoring case
+// and runs of whitespace.
+func avoidHits(text string, avoid []string) []string {
+	norm := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	t := norm(text)
+	var out []string
+	for _, a := range avoid {
+		if p := norm(a); p != "" && strings.Contains(t, p) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func avoidFlags(hits []string) []string {
+	out := make([]string, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, "avoid: "+h)
+	}
+	return out
+}
+
+// generateCmd writes drafts with the configured generator. Drafts that use
+// a phrase from ai.avoid are kept but flagged, so they are not posted
+// unnoticed.
+func generateCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) > 0 && args[0] == "pick" {
+		return generatePickCmd(args[1:], ctx)
+	}
+	usage := cliFail("INVALID_ARGS", "Usage: tweet generate <topic>", map[string]any{"examples": []string{"tweet generate thread <topic>", "tweet generate ideas [--topic <topic>]", "tweet generate <topic> --offline", "tweet generate <topic> --prompt <name>", "tweet generate <topic> --variants 5 [--pick]", "tweet generate pick <genId> <n>..."}})
+	offline, pick, topicFlag, promptName, variants := false, false, "", "", 1
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--offline":
+			offline = true
+		case args[i] == "--pick":
+			pick = true
+		case args[i] == "--variants" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 || n > maxVariants {
+				return nil, cliFail("INVALID_ARGS", fmt.Sprintf("--variants takes a number from 1 to %d", maxVariants), nil)
+			}
+			variants = n
+			i++
+		case args[i] == "--topic" && i+1 < len(args):
+			topicFlag = args[i+1]
+			i++
+		case args[i] == "--prompt" && i+1 < len(args):
+			promptName = args[i+1]
+			i++
+		case args[i] == "--variants", args[i] == "--topic", args[i] == "--prompt":
+			// A valued flag with nothing after it; not part of the topic.
+			return nil, usage
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	args = rest
+	if len(args) == 0 {
+		return nil, usage
+	}
+	if (variants > 1 || pick) && (args[0] == "ideas" || args[0] == "thread") {
+		return nil, cliFail("INVALID_ARGS", "--variants and --pick work with single tweets only", nil)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	var gen Generator = templateGenerator{}
+	if !offline {
+		if gen, err = newGenerator(cfg); err != nil {
+			return nil, err
+		}
+	}
+	warnings := []string{}
+	flag := avoidFlagger(cfg, &warnings)
+	printWarnings := func() {
+		if !ctx.JSON {
+			for _, w := range warnings {
+				fmt.Println("  Warning:", w)
+			}
+		}
+	}
+	if args[0] == "ideas" {
+		topics := cfg.AI.Topics
+		if t := strings.TrimSpace(first(topicFlag, strings.Join(args[1:], " "))); t != "" {
+			topics = []string{t}
+		}
+		req, err := genPrompt(promptName, "ideas", "", topics, cfg)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := gen.Generate(req)
+		if err != nil {
+			return nil, err
+		}
+		genID := logGen(Gen{Prompt: req.Prompt, Output: raw, Model: gen.Name(), Mode: req.Mode})
+		flagged := []string{}
+		for _, ln := range strings.Split(raw, "\n") {
+			if len(flag("idea", ln)) > 0 {
+				flagged = append(flagged, strings.TrimSpace(ln))
+			}
+		}
+		if !ctx.JSON {
+			fmt.Println()
+			fmt.Println(raw)
+			fmt.Println()
+		}
+		printWarnings()
+		return map[string]any{"mode": "ideas", "model": gen.Name(), "genId": genID, "topics": topics, "raw": raw, "flagged": flagged, "warnings": warnings}, nil
+	}
+	if args[0] == "thread" {
+		topic := strings.TrimSpace(strings.Join(args[1:], " "))
+		if topic == "" {
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet generate thread <topic>", nil)
+		}
+		if !ctx.JSON {
+			fmt.Println("  Generating thread about:", topic)
+		}
+		req, err := genPrompt(promptName, "thread", topic, nil, cfg)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := gen.Generate(req)
+		if err != nil {
+			return nil, err
+		}
+		genID := logGen(Gen{Prompt: req.Prompt, Output: raw, Model: gen.Name(), Mode: req.Mode, Topic: topic})
+		out, err := draftThread(raw, topic, genID, flag, ctx)
+		if err != nil {
+			return nil, err
+		}
+		printWarnings()
+		return map[string]any{"mode": "thread", "topic": topic, "model": gen.Name(), "genId": genID, "tweets": out, "raw": raw, "warnings": warnings}, nil
+	}
+	topic := strings.TrimSpace(strings.Join(args, " "))
+	req, err := genPrompt(promptName, "single", topic, nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if variants > 1 || pick {
+		return generateVariants(gen, req, variants, pick, cfg, ctx)
+	}
+	raw, err := gen.Generate(req)
+	if err != nil {
+		return nil, err
+	}
+	genID := logGen(Gen{Prompt: req.Prompt, Output: raw, Model: gen.Name(), Mode: req.Mode, Topic: topic})
+	tw, err := draftSingle(cleanSingle(raw), topic, genID, flag)
+	if err != nil {
+		return nil, err
+	}
+	if w := lengthWarning(tw.Content); w != "" {
+		warnings = append(warnings, w)
+	}
+	if !ctx.JSON {
+		fmt.Println("  Generated", tw.ID)
+		fmt.Println(" ", tw.Content)
+	}
+	printWarnings()
+	return map[string]any{"mode": "single", "topic": topic, "model": gen.Name(), "genId": genID, "tweets": []Tweet{tw}, "raw": raw, "warnings": warnings}, nil
+}
+
+// avoidFlagger returns the flags for text and, when warnings is set, adds a
+// warning per avoided phrase to it.
+func avoidFlagger(cfg Config, warnings *[]string) func(label, text string) []string {
+	return func(label, text string) []string {
+		hits := avoidHits(text, cfg.AI.Avoid)
+		for i := 0; warnings != nil && i < len(hits); i++ {
+			*warnings = append(*warnings, fmt.Sprintf("%s uses avoided phrase %q", label, hits[i]))
+		}
+		return avoidFlags(hits)
+	}
+}
+
+// logGen records g in the generation history and returns its ID. History is
+// best effort: if it cannot be saved the drafts just carry no GenID.
+func logGen(g Gen) string {
+	g, err := saveGen(g)
+	if err != nil {
+		return ""
+	}
+	return g.ID
+}
+
+// draftSingle saves text as a draft from generation genID; flag reports the
+// avoided phrases it uses.
+func draftSingle(text, topic, genID string, flag func(label, text string) []string) (Tweet, error) {
+	tg := topic
+	tw := newTweet(text, nil, 0, &tg)
+	tw.Flags = flag("draft", text)
+	tw.GenID = genID
+	return insertTweet(tw)
+}
+
+// draftThread saves generated thread output as a new thread of drafts, in
+// one store write so a failure leaves no partial thread behind.
+func draftThread(raw, topic, genID string, flag func(label, text string) []string, ctx Ctx) ([]Tweet, error) {
+	tid := newID(12)
+	out := []Tweet{}
+	for _, p := range threadParts(raw) {
+		// A part over the limit becomes several tweets instead of being cut.
+		for _, q := range splitThread(p, maxTweetLength, false) {
+			th := tid
+			tg := topic
+			tw := newTweet(q, &th, len(out), &tg)
+			tw.Flags = flag(fmt.Sprintf("tweet %d", len(out)+1), q)
+			tw.GenID = genID
+			out = append(out, tw)
+		}
+	}
+	if err := putTweets(out...); err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		for _, tw := range out {
+			fmt.Printf("  [%d] %s\n", tw.ThreadPos+1, tw.Content)
+		}
+	}
+	return out, nil
+}
+
+// maxVariants caps generate --variants; each variant is a separate request.
+const maxVariants = 10
+
+// generateVariants asks for n candidates of one tweet and keeps them on the
+// generation record. With pick it asks which to keep; otherwise they wait
+// for generate pick.
+func generateVariants(gen Generator, req genRequest, n int, pick bool, cfg Config, ctx Ctx) (any, error) {
+	g := Gen{Prompt: req.Prompt, Model: gen.Name(), Mode: req.Mode, Topic: req.Topic}
+	for i := 0; i < n; i++ {
+		req.Variant = i
+		raw, err := gen.Generate(req)
+		if err != nil {
+			return nil, err
+		}
+		g.Variants = append(g.Variants, cleanSingle(raw))
+	}
+	g, err := saveGen(g)
+	if err != nil {
+		return nil, err
+	}
+	type variant struct {
+		N       int      `json:"n"`
+		Content string   `json:"content"`
+		Flags   []string `json:"flags,omitempty"`
+		Warning string   `json:"warning,omitempty"`
+	}
+	out := make([]variant, len(g.Variants))
+	for i, v := range g.Variants {
+		out[i] = variant{N: i + 1, Content: v, Flags: avoidFlags(avoidHits(v, cfg.AI.Avoid)), Warning: lengthWarning(v)}
+	}
+	if !ctx.JSON {
+		fmt.Println()
+		for _, v := range out {
+			fmt.Printf("  [%d] %s\n", v.N, v.Content)
+			for _, f := range v.Flags {
+				fmt.Println("      flagged:", f)
+			}
+			if v.Warning != "" {
+				fmt.Println("      warning:", v.Warning)
+			}
+		}
+		fmt.Println()
+	}
+	res := map[string]any{"mode": "variants", "topic": req.Topic, "model": gen.Name(), "genId": g.ID, "variants": out}
+	if !pick {
+		if !ctx.JSON {
+			fmt.Println("  Keep some with: tweet generate pick", g.ID, "<n>...")
+		}
+		return res, nil
+	}
+	line, err := readLine(fmt.Sprintf("  Keep which variants (1-%d, empty for none): ", len(out)))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if strings.TrimSpace(line) == "" {
+		res["tweets"] = []Tweet{}
+		return res, nil
+	}
+	picked, err := pickVariants(g, strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }), cfg, ctx)
+	if err != nil {
+		return nil, err
+	}
+	res["tweets"] = picked
+	return res, nil
+}
+
+// generatePickCmd turns chosen variants of a generation into drafts.
+func generatePickCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) < 2 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet generate pick <genId> <n>...", nil)
+	}
+	g, err := getGen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, cliFail("NOT_FOUND", "Generation not found: "+args[0], nil)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	out, err := pickVariants(*g, args[1:], cfg, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"genId": g.ID, "tweets": out}, nil
+}
+
+// pickVariants drafts the variants numbered in picks and records the choice
+// on the generation; the others are never drafted. The choice is recorded
+// under the store lock before anything is drafted, so two picks of the same
+// generation cannot both draft; if drafting then fails, `generations
+// redraft` makes the missing drafts.
+func pickVariants(g Gen, picks []string, cfg Config, ctx Ctx) ([]Tweet, error) {
+	if len(g.Variants) == 0 {
+		return nil, cliFail("INVALID_ARGS", "Generation "+g.ID+" has no variants", nil)
+	}
+	nums := []int{}
+	seen := map[int]bool{}
+	for _, p := range picks {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > len(g.Variants) {
+			return nil, cliFail("INVALID_ARGS", fmt.Sprintf("Pick variants by number, 1 to %d: %s", len(g.Variants), p), nil)
+		}
+		if !seen[n] {
+			seen[n] = true
+			nums = append(nums, n)
+		}
+	}
+	s, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.UpdateGen(g.ID, func(cur *Gen) error {
+		if len(cur.Picked) > 0 {
+			return cliFail("CONFLICT", "Variants of "+g.ID+" were already picked", map[string]any{"picked": cur.Picked})
+		}
+		cur.Picked = nums
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cur == nil {
+		return nil, cliFail("NOT_FOUND", "Generation not found: "+g.ID, nil)
+	}
+	out := []Tweet{}
+	for _, n := range nums {
+		tw, err := draftSingle(cur.Variants[n-1], cur.Topic, cur.ID, avoidFlagger(cfg, nil))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tw)
+		if !ctx.JSON {
+			fmt.Printf("  Drafted [%d] as %s\n", n, tw.ID)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withFakeLLM serves chat completions with reply and points the openai
+// provider at it.
+func withFakeLLM(t *testing.T, reply func(prompt string) (int, string)) *[]map[string]any {
+	var seen []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusUnauthorized)
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		seen = append(seen, body)
+		msgs := body["messages"].([]any)
+		code, text := reply(msgs[len(msgs)-1].(map[string]any)["content"].(string))
+		if code != http.StatusOK {
+			w.WriteHeader(code)
+			_, _ = w.Write([]byte(text))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": text}}}})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("XPOSTCTL_AI_PROVIDER", "openai")
+	t.Setenv("XPOSTCTL_AI_BASE_URL", srv.URL+"/v1")
+	t.Setenv("XPOSTCTL_AI_MODEL", "test-model")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	return &seen
+}
+
+func TestGenerateWithOpenAICompatibleProvider(t *testing.T) {
+	withTempCwd(t, func() {
+		seen := withFakeLLM(t, func(prompt string) (int, string) {
+			if strings.Contains(prompt, "thread") {
+				return http.StatusOK, "First point about caching.\n---\nSecond point.\n\n---\nThird point."
+			}
+			return http.StatusOK, `"Caching is a promise you make to your future self."`
+		})
+		ctx := Ctx{JSON: true}
+		res, err := generateCmd([]string{"caching"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := res.(map[string]any)["tweets"].([]Tweet)[0]
+		if tw.Content != "Caching is a promise you make to your future self." {
+			t.Fatalf("content=%q", tw.Content)
+		}
+		if (*seen)[0]["model"] != "test-model" {
+			t.Fatalf("request=%v", (*seen)[0])
+		}
+		res, err = generateCmd([]string{"thread", "caching"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.(map[string]any)["tweets"].([]Tweet); len(got) != 3 || got[2].Content != "Third point." {
+			t.Fatalf("thread=%+v", got)
+		}
+		gens, _ := listGensForTest(t)
+		if len(gens) != 2 || gens[0].Model != "test-model" {
+			t.Fatalf("gens=%+v", gens)
+		}
+	})
+}
+
+func TestGenerateProviderErrors(t *testing.T) {
+	withTempCwd(t, func() {
+		withFakeLLM(t, func(string) (int, string) {
+			return http.StatusTooManyRequests, `{"error":{"message":"quota exceeded"}}`
+		})
+		_, err := generateCmd([]string{"caching"}, Ctx{JSON: true})
+		if ce, ok := err.(*CliErr); !ok || ce.Code != "GENERATE_FAILED" || !strings.Contains(ce.Msg, "quota exceeded") {
+			t.Fatalf("err=%v", err)
+		}
+		res, err := generateCmd([]string{"caching", "--offline"}, Ctx{JSON: true})
+		if err != nil || res.(map[string]any)["model"] != templateProvider {
+			t.Fatalf("offline res=%v err=%v", res, err)
+		}
+
+		t.Setenv("XPOSTCTL_AI_BASE_URL", "")
+		t.Setenv("OPENAI_API_KEY", "")
+		if _, err := generateCmd([]string{"caching"}, Ctx{JSON: true}); err == nil || err.(*CliErr).Code != "INVALID_CONFIG" {
+			t.Fatalf("missing key err=%v", err)
+		}
+	})
+}
+
+func TestThreadParts(t *testing.T) {
+	got := threadParts("one\n---\n\n two \n-----\n---\nthree")
+	if strings.Join(got, "|") != "one|two|three" {
+		t.Fatalf("parts=%q", got)
+	}
+}
+
+// failingPuts is a store that refuses any write containing the content bad.
+type failingPuts struct {
+	Store
+	bad string
+}
+
+func (f failingPuts) PutTweets(items ...Tweet) error {
+	for _, t := range items {
+		if t.Content == f.bad {
+			return errors.New("disk full")
+		}
+	}
+	return f.Store.PutTweets(items...)
+}
+
+func TestDraftThreadSavesAllOrNothing(t *testing.T) {
+	withTempCwd(t, func() {
+		flag := func(string, string) []string { return nil }
+		out, err := draftThread("one\n---\ntwo\n---\nthree", "go", "", flag, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		members, _ := threadTweets(*out[0].ThreadID)
+		if len(members) != 3 || members[2].Content != "three" || members[2].ThreadPos != 2 {
+			t.Fatalf("members=%+v", members)
+		}
+
+		s, err := openStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := storeBackend() + "|" + dataDir()
+		storeMu.Lock()
+		stores[key] = failingPuts{Store: s, bad: "five"}
+		storeMu.Unlock()
+		t.Cleanup(func() {
+			storeMu.Lock()
+			stores[key] = s
+			storeMu.Unlock()
+		})
+		if _, err := draftThread("four\n---\nfive", "go", "", flag, Ctx{JSON: true}); err == nil {
+			t.Fatal("draftThread succeeded with a failing store")
+		}
+		all, _ := s.ListTweets("")
+		for _, tw := range all {
+			if tw.Content == "four" {
+				t.Fatalf("half of the failed thread was saved: %+v", tw)
+			}
+		}
+	})
+}
+
+func listGensForTest(t *testing.T) ([]Gen, error) {
+	t.Helper()
+	s, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.ListGens()
+}
+
+func TestGenerateUsesAIConfig(t *testing.T) {
+	withTempCwd(t, func() {
+		seen := withFakeLLM(t, func(string) (int, string) {
+			return http.StatusOK, "Hot take: Like  and RETWEET if you agree that tests matter."
+		})
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeJSON(cfgPath(), map[string]any{"ai": map[string]any{"topics": []string{"Go", "SQLite"}, "tone": "dry", "avoid": []string{"like and retweet"}}}); err != nil {
+			t.Fatal(err)
+		}
+		ctx := Ctx{JSON: true}
+		res, err := generateCmd([]string{"testing"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		system := (*seen)[0]["messages"].([]any)[0].(map[string]any)["content"].(string)
+		if !strings.Contains(system, "Tone: dry") || !strings.Contains(system, "like and retweet") {
+			t.Fatalf("system=%q", system)
+		}
+		tw := res.(map[string]any)["tweets"].([]Tweet)[0]
+		if len(tw.Flags) != 1 || len(res.(map[string]any)["warnings"].([]string)) != 1 {
+			t.Fatalf("flags=%v res=%v", tw.Flags, res)
+		}
+		if _, err := postCmd([]string{tw.ID, "--dry"}, ctx); err == nil || err.(*CliErr).Code != "FLAGGED" {
+			t.Fatalf("post flagged err=%v", err)
+		}
+		if _, err := scheduleCmd([]string{tw.ID, "--at", "in 2h"}, ctx); err == nil || err.(*CliErr).Code != "FLAGGED" {
+			t.Fatalf("schedule flagged err=%v", err)
+		}
+		if _, err := scheduleCmd([]string{tw.ID, "--at", "in 2h", "--force"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := getTweet(tw.ID); !got.FlagsAccepted {
+			t.Fatalf("schedule --force not recorded: %+v", got)
+		}
+		if _, err := scheduleCmd([]string{"cancel", tw.ID}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := draftCmd([]string{"--edit", tw.ID, "Tests matter."}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := getTweet(tw.ID); len(got.Flags) != 0 || got.FlagsAccepted {
+			t.Fatalf("flags after edit=%v accepted=%v", got.Flags, got.FlagsAccepted)
+		}
+
+		res, err = generateCmd([]string{"ideas", "--offline"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw := res.(map[string]any)["raw"].(string)
+		if !strings.Contains(raw, "Go") || !strings.Contains(raw, "SQLite") {
+			t.Fatalf("ideas=%q", raw)
+		}
+		res, _ = generateCmd([]string{"ideas", "--topic", "Rust", "--offline"}, ctx)
+		if raw := res.(map[string]any)["raw"].(string); strings.Contains(raw, "SQLite") || !strings.Contains(raw, "Rust") {
+			t.Fatalf("ideas=%q", raw)
+		}
+	})
+}
+
+func TestGenerateVariantsAndPick(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		res, err := generateCmd([]string{"caching", "--variants", "3", "--offline"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := res.(map[string]any)
+		genID := m["genId"].(string)
+		if drafts, _ := listTweets(draftStatus); len(drafts) != 0 {
+			t.Fatalf("variants drafted before pick: %d", len(drafts))
+		}
+		g, _ := getGen(genID)
+		if g == nil || len(g.Variants) != 3 || g.Variants[0] == g.Variants[1] {
+			t.Fatalf("gen=%+v", g)
+		}
+		if _, err := generateCmd([]string{"pick", genID, "4"}, ctx); err == nil || err.(*CliErr).Code != "INVALID_ARGS" {
+			t.Fatalf("out of range err=%v", err)
+		}
+		for _, flag := range []string{"--variants", "--topic", "--prompt"} {
+			if _, err := generateCmd([]string{"caching", "--offline", flag}, ctx); err == nil || err.(*CliErr).Code != "INVALID_ARGS" {
+				t.Fatalf("trailing %s err=%v", flag, err)
+			}
+		}
+		if drafts, _ := listTweets(draftStatus); len(drafts) != 0 {
+			t.Fatalf("a trailing flag was drafted into the topic: %+v", drafts)
+		}
+		res, err = generateCmd([]string{"pick", genID, "3", "1"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweets := res.(map[string]any)["tweets"].([]Tweet)
+		if len(tweets) != 2 || tweets[0].Content != g.Variants[2] || tweets[1].Content != g.Variants[0] {
+			t.Fatalf("tweets=%+v", tweets)
+		}
+		if g, _ = getGen(genID); len(g.Picked) != 2 {
+			t.Fatalf("picked=%v", g.Picked)
+		}
+		if _, err := generateCmd([]string{"pick", genID, "2"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("re-pick err=%v", err)
+		}
+		if _, err := generateCmd([]string{"thread", "caching", "--variants", "2"}, ctx); err == nil || err.(*CliErr).Code != "INVALID_ARGS" {
+			t.Fatalf("thread variants err=%v", err)
+		}
+
+		orig := stdinLines
+		t.Cleanup(func() { stdinLines = orig })
+		stdinLines = bufio.NewReader(strings.NewReader("2\n"))
+		res, err = generateCmd([]string{"queues", "--variants", "2", "--pick", "--offline"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.(map[string]any)["tweets"].([]Tweet); len(got) != 1 || !strings.Contains(got[0].Content, "queues") {
+			t.Fatalf("interactive pick=%+v", got)
+		}
+		if drafts, _ := listTweets(draftStatus); len(drafts) != 3 {
+			t.Fatalf("drafts=%d", len(drafts))
+		}
+	})
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// genListLimit is how many generations list shows without --limit.
+const genListLimit = 20
+
+var ageRe = regexp.MustCompile(`^(\d+)([mhdw])$`)
+
+// parseAge reads ages like 90m, 12h, 30d or 2w.
+func parseAge(s string) (time.Duration, error) {
+	m := ageRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[m[2]]
+	return time.Duration(n) * unit, nil
+}
+
+// listGens returns generation history, newest first.
+func listGens() ([]Gen, error) {
+	s, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	gens, err := s.ListGens()
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(gens)
+	return gens, nil
+}
+
+// genSummary is the first line of a generation's output, or of its first
+// variant, shortened for listings.
+func genSummary(g Gen) string {
+	text := g.Output
+	if len(g.Variants) > 0 {
+		text = fmt.Sprintf("(%d variants) %s", len(g.Variants), g.Variants[0])
+	}
+	text, _, _ = strings.Cut(strings.TrimSpace(text), "\n")
+	if weightedLength(text) > 60 {
+		text = truncateWeighted(text, 60) + "..."
+	}
+	return text
+}
+
+func printGens(title string, gens []Gen) {
+	if len(gens) == 0 {
+		fmt.Println("  No generations found")
+		return
+	}
+	fmt.Printf("\n  %s\n\n", title)
+	for _, g := range gens {
+		label := first(g.Mode, "generation")
+		if g.Topic != "" {
+			label += ": " + g.Topic
+		}
+		fmt.Printf("  %s %s [%s] %s\n", g.ID, g.CreatedAt, g.Model, label)
+		fmt.Println("   ", genSummary(g))
+	}
+	fmt.Println()
+}
+
+func generationsCmd(args []string, ctx Ctx) (any, error) {
+	if err := ensureData(); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		if len(args) > 0 {
+			args = args[1:]
+		}
+		return genListCmd(args, ctx)
+	}
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet generations get <id>", nil)
+		}
+		return genGetCmd(args[1], ctx)
+	case "search":
+		q := strings.TrimSpace(strings.Join(args[1:], " "))
+		if q == "" {
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet generations search <text>", nil)
+		}
+		return genSearchCmd(q, ctx)
+	case "rm", "remove":
+		if len(args) < 2 {
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet generations rm <id>...", nil)
+		}
+		return genRemoveCmd(args[1:], ctx)
+	case "prune":
+		return genPruneCmd(args[1:], ctx)
+	case "redraft":
+		if len(args) < 2 || len(args) > 3 {
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet generations redraft <id> [variant]", nil)
+		}
+		return genRedraftCmd(args[1], args[2:], ctx)
+	default:
+		return nil, cliFail("INVALID_ARGS", "Unknown generations subcommand: "+args[0], map[string]any{"available": []string{"list", "get", "search", "rm", "prune", "redraft"}})
+	}
+}
+
+func genListCmd(args []string, ctx Ctx) (any, error) {
+	limit := genListLimit
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--all":
+			limit = 0
+		case args[i] == "--limit" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return nil, cliFail("INVALID_ARGS", "--limit takes a positive number", nil)
+			}
+			limit = n
+			i++
+		default:
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet generations list [--limit n|--all]", nil)
+		}
+	}
+	gens, err := listGens()
+	if err != nil {
+		return nil, err
+	}
+	total := len(gens)
+	if limit > 0 && len(gens) > limit {
+		gens = gens[:limit]
+	}
+	if !ctx.JSON {
+		printGens(fmt.Sprintf("Generations (newest %d of %d)", len(gens), total), gens)
+	}
+	return map[string]any{"count": total, "generations": gens}, nil
+}
+
+// genDrafts returns the tweets made from generation id.
+func genDrafts(id string) ([]Tweet, error) {
+	all, err := listTweets("")
+	if err != nil {
+		return nil, err
+	}
+	out := []Tweet{}
+	for _, t := range all {
+		if t.GenID == id {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func mustGen(id string) (*Gen, error) {
+	g, err := getGen(id)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, cliFail("NOT_FOUND", "Generation not found: "+id, nil)
+	}
+	return g, nil
+}
+
+func genGetCmd(id string, ctx Ctx) (any, error) {
+	g, err := mustGen(id)
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := genDrafts(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("\n  %s [%s]\n", g.ID, g.Model)
+		fmt.Println("  created:", g.CreatedAt)
+		if g.Mode != "" {
+			fmt.Println("  mode:", g.Mode)
+		}
+		if g.Topic != "" {
+			fmt.Println("  topic:", g.Topic)
+		}
+		fmt.Println("  prompt:")
+		fmt.Println("   ", strings.ReplaceAll(g.Prompt, "\n", "\n    "))
+		if len(g.Variants) > 0 {
+			fmt.Println("  variants:")
+			for i, v := range g.Variants {
+				mark := " "
+				if slices.Contains(g.Picked, i+1) {
+					mark = "*"
+				}
+				fmt.Printf("   %s[%d] %s\n", mark, i+1, v)
+			}
+		} else {
+			fmt.Println("  output:")
+			fmt.Println("   ", strings.ReplaceAll(g.Output, "\n", "\n    "))
+		}
+		for _, t := range drafts {
+			fmt.Printf("  draft: %s [%s]\n", t.ID, t.Status)
+		}
+		fmt.Println()
+	}
+	return map[string]any{"generation": g, "drafts": drafts}, nil
+}
+
+func genSearchCmd(q string, ctx Ctx) (any, error) {
+	gens, err := listGens()
+	if err != nil {
+		return nil, err
+	}
+	needle := strings.ToLower(q)
+	out := []Gen{}
+	for _, g := range gens {
+		hay := strings.ToLower(strings.Join(append([]string{g.Prompt, g.Output, g.Topic, g.Model}, g.Variants...), "\n"))
+		if strings.Contains(hay, needle) {
+			out = append(out, g)
+		}
+	}
+	if !ctx.JSON {
+		printGens(fmt.Sprintf("Generations matching %q (%d)", q, len(out)), out)
+	}
+	return map[string]any{"query": q, "count": len(out), "generations": out}, nil
+}
+
+func genRemoveCmd(ids []string, ctx Ctx) (any, error) {
+	for _, id := range ids {
+		if _, err := mustGen(id); err != nil {
+			return nil, err
+		}
+	}
+	s, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DeleteGens(ids...); err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Removed %d generation(s)\n", len(ids))
+	}
+	return map[string]any{"removed": ids}, nil
+}
+
+// genPruneCmd removes generations created before --older-than ago. Drafts
+// made from them stay and keep their GenID.
+func genPruneCmd(args []string, ctx Ctx) (any, error) {
+	usage := cliFail("INVALID_ARGS", "Usage: tweet generations prune --older-than <age> [--dry]", map[string]any{"examples": []string{"tweet generations prune --older-than 30d", "tweet generations prune --older-than 2w --dry"}})
+	var age time.Duration
+	dry, set := false, false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--dry":
+			dry = true
+		case args[i] == "--older-than" && i+1 < len(args):
+			d, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, cliFail("INVALID_ARGS", "--older-than takes an age like 30d, 12h or 2w", nil)
+			}
+			age, set = d, true
+			i++
+		default:
+			return nil, usage
+		}
+	}
+	if !set {
+		return nil, usage
+	}
+	gens, err := listGens()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().UTC().Add(-age)
+	ids := []string{}
+	for _, g := range gens {
+		if at, err := time.Parse(time.RFC3339, g.CreatedAt); err == nil && at.Before(cutoff) {
+			ids = append(ids, g.ID)
+		}
+	}
+	if !dry && len(ids) > 0 {
+		s, err := openStore()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.DeleteGens(ids...); err != nil {
+			return nil, err
+		}
+	}
+	if !ctx.JSON {
+		verb := "Removed"
+		if dry {
+			verb = "Would remove"
+		}
+		fmt.Printf("  %s %d generation(s) from before %s\n", verb, len(ids), cutoff.Format(time.RFC3339))
+	}
+	return map[string]any{"removed": ids, "before": cutoff.Format(time.RFC3339), "dry": dry}, nil
+}
+
+var listItemRe = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*•])\s+\S`)
+
+// looksLikeIdeas reports whether output is a list of ideas: three or more
+// lines, every one a numbered or bulleted item. Generations saved before
+// modes were recorded have no Mode, so this is how their ideas are told
+// apart from drafts.
+func looksLikeIdeas(output string) bool {
+	n := 0
+	for _, ln := range strings.Split(output, "\n") {
+		if strings.TrimSpace(ln) == "" {
+			continue
+		}
+		if !listItemRe.MatchString(ln) {
+			return false
+		}
+		n++
+	}
+	return n >= 3
+}
+
+// genRedraftCmd makes new drafts from a past generation's output, or from one
+// of its variants. Past picks do not matter: redraft always adds drafts.
+func genRedraftCmd(id string, rest []string, ctx Ctx) (any, error) {
+	g, err := mustGen(id)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	warnings := []string{}
+	flag := avoidFlagger(cfg, &warnings)
+	var out []Tweet
+	switch {
+	case len(g.Variants) > 0:
+		n := 0
+		if len(rest) == 1 {
+			n, _ = strconv.Atoi(rest[0])
+		}
+		if n < 1 || n > len(g.Variants) {
+			return nil, cliFail("INVALID_ARGS", fmt.Sprintf("Generation %s has %d variants; name one", g.ID, len(g.Variants)), map[string]any{"hint": "tweet generations redraft " + g.ID + " <n>"})
+		}
+		tw, err := draftSingle(g.Variants[n-1], g.Topic, g.ID, flag)
+		if err != nil {
+			return nil, err
+		}
+		out = []Tweet{tw}
+	case len(rest) > 0:
+		return nil, cliFail("INVALID_ARGS", "Generation "+g.ID+" has no variants", nil)
+	case g.Mode == "ideas" || (g.Mode == "" && looksLikeIdeas(g.Output)):
+		return nil, cliFail("INVALID_ARGS", "Ideas are not drafts; generate one of them instead", map[string]any{"hint": "tweet generate <idea>"})
+	case g.Mode == "thread" || (g.Mode == "" && len(threadParts(g.Output)) > 1):
+		if out, err = draftThread(g.Output, g.Topic, g.ID, flag, ctx); err != nil {
+			return nil, err
+		}
+	default:
+		tw, err := draftSingle(cleanSingle(g.Output), g.Topic, g.ID, flag)
+		if err != nil {
+			return nil, err
+		}
+		if w := lengthWarning(tw.Content); w != "" {
+			warnings = append(warnings, w)
+		}
+		out = []Tweet{tw}
+	}
+	if !ctx.JSON {
+		if len(out) == 1 {
+			fmt.Println("  Drafted", out[0].ID)
+			fmt.Println(" ", out[0].Content)
+		}
+		for _, w := range warnings {
+			fmt.Println("  Warning:", w)
+		}
+	}
+	return map[string]any{"genId": g.ID, "tweets": out, "warnings": warnings}, nil
+}
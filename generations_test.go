@@ -0,0 +1,188 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestGenerationsHistoryAndRedraft(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		res, err := generateCmd([]string{"caching", "--offline"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		single := res.(map[string]any)["genId"].(string)
+		if tw := res.(map[string]any)["tweets"].([]Tweet)[0]; tw.GenID != single {
+			t.Fatalf("gen_id=%q want %q", tw.GenID, single)
+		}
+		res, err = generateCmd([]string{"thread", "queues", "--offline"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thread := res.(map[string]any)["genId"].(string)
+		threadLen := len(res.(map[string]any)["tweets"].([]Tweet))
+		res, _ = generateCmd([]string{"retries", "--variants", "2", "--offline"}, ctx)
+		variants := res.(map[string]any)["genId"].(string)
+
+		res, err = generationsCmd([]string{"list", "--limit", "2"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gens := res.(map[string]any)["generations"].([]Gen)
+		if res.(map[string]any)["count"] != 3 || len(gens) != 2 || gens[0].ID != variants || gens[1].ID != thread {
+			t.Fatalf("list=%+v", res)
+		}
+		res, _ = generationsCmd([]string{"search", "QUEUES"}, ctx)
+		if got := res.(map[string]any)["generations"].([]Gen); len(got) != 1 || got[0].ID != thread {
+			t.Fatalf("search=%+v", got)
+		}
+		res, _ = generationsCmd([]string{"get", single}, ctx)
+		if d := res.(map[string]any)["drafts"].([]Tweet); len(d) != 1 {
+			t.Fatalf("drafts=%+v", d)
+		}
+
+		res, err = generationsCmd([]string{"redraft", thread}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.(map[string]any)["tweets"].([]Tweet); len(got) != threadLen || got[0].ThreadID == nil || got[0].GenID != thread {
+			t.Fatalf("thread redraft=%+v", got)
+		}
+		if _, err := generationsCmd([]string{"redraft", variants}, ctx); err == nil || err.(*CliErr).Code != "INVALID_ARGS" {
+			t.Fatalf("variant redraft without n err=%v", err)
+		}
+		res, err = generationsCmd([]string{"redraft", variants, "2"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, _ := getGen(variants)
+		if got := res.(map[string]any)["tweets"].([]Tweet); got[0].Content != g.Variants[1] || got[0].GenID != variants {
+			t.Fatalf("variant redraft=%+v", got)
+		}
+		if _, err := generationsCmd([]string{"redraft", single}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		res, _ = generationsCmd([]string{"get", single}, ctx)
+		if d := res.(map[string]any)["drafts"].([]Tweet); len(d) != 2 {
+			t.Fatalf("drafts after redraft=%+v", d)
+		}
+		if _, err := generationsCmd([]string{"get", "nope"}, ctx); err == nil || err.(*CliErr).Code != "NOT_FOUND" {
+			t.Fatalf("missing err=%v", err)
+		}
+
+		// Generations from before modes were recorded.
+		ideas, _ := saveGen(Gen{Output: templateIdeas([]string{"go"})})
+		if _, err := generationsCmd([]string{"redraft", ideas.ID}, ctx); err == nil || err.(*CliErr).Code != "INVALID_ARGS" {
+			t.Fatalf("legacy ideas redraft err=%v", err)
+		}
+		legacy, _ := saveGen(Gen{Output: "1. Ship small.\nThen ship again."})
+		res, err = generationsCmd([]string{"redraft", legacy.ID}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.(map[string]any)["tweets"].([]Tweet); len(got) != 1 || got[0].ThreadID != nil {
+			t.Fatalf("legacy single redraft=%+v", got)
+		}
+	})
+}
+
+func TestGenerationsPruneAndRemove(t *testing.T) {
+	for _, backend := range []string{jsonBackend, sqliteBackend} {
+		t.Run(backend, func(t *testing.T) {
+			withTempCwd(t, func() {
+				t.Setenv("XPOSTCTL_STORE", backend)
+				ctx := Ctx{JSON: true}
+				old := time.Now().UTC().AddDate(0, 0, -45).Format(time.RFC3339)
+				if _, err := saveGen(Gen{ID: "old1", Prompt: "p", Output: "o", Model: "template", CreatedAt: old}); err != nil {
+					t.Fatal(err)
+				}
+				keep, _ := saveGen(Gen{Prompt: "p", Output: "o", Model: "template"})
+				drop, _ := saveGen(Gen{Prompt: "p", Output: "o", Model: "template"})
+
+				if _, err := generationsCmd([]string{"prune", "--older-than", "30x"}, ctx); err == nil || err.(*CliErr).Code != "INVALID_ARGS" {
+					t.Fatalf("bad age err=%v", err)
+				}
+				res, err := generationsCmd([]string{"prune", "--older-than", "30d", "--dry"}, ctx)
+				if err != nil || len(res.(map[string]any)["removed"].([]string)) != 1 {
+					t.Fatalf("dry res=%v err=%v", res, err)
+				}
+				if g, _ := getGen("old1"); g == nil {
+					t.Fatal("dry run removed a generation")
+				}
+				if _, err := generationsCmd([]string{"prune", "--older-than", "30d"}, ctx); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := generationsCmd([]string{"rm", drop.ID}, ctx); err != nil {
+					t.Fatal(err)
+				}
+				gens, _ := listGens()
+				if len(gens) != 1 || gens[0].ID != keep.ID {
+					t.Fatalf("gens=%+v", gens)
+				}
+				if _, err := generationsCmd([]string{"rm", drop.ID}, ctx); err == nil || err.(*CliErr).Code != "NOT_FOUND" {
+					t.Fatalf("rm missing err=%v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{"90m": 90 * time.Minute, "12h": 12 * time.Hour, "30d": 720 * time.Hour, "2W": 336 * time.Hour} {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Fatalf("parseAge(%q)=%v, %v", in, got, err)
+		}
+	}
+	if _, err := parseAge("30"); err == nil {
+		t.Fatal("bare number accepted")
+	}
+}
+
+func TestConcurrentPicksDraftOnce(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend, func(t *testing.T) {
+			withTempCwd(t, func() {
+				t.Setenv("XPOSTCTL_STORE", backend)
+				ctx := Ctx{JSON: true}
+				res, err := generateCmd([]string{"retries", "--variants", "3", "--offline"}, ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				id := res.(map[string]any)["genId"].(string)
+				var wg sync.WaitGroup
+				errs := make([]error, 4)
+				for i := range errs {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						_, errs[i] = generateCmd([]string{"pick", id, "1", "2"}, ctx)
+					}()
+				}
+				wg.Wait()
+				ok := 0
+				for _, err := range errs {
+					if err == nil {
+						ok++
+					} else if ce, _ := err.(*CliErr); ce == nil || (ce.Code != "CONFLICT" && ce.Code != "LOCKED") {
+						t.Fatalf("pick err=%v", err)
+					}
+				}
+				drafts, _ := genDrafts(id)
+				if ok != 1 || len(drafts) != 2 {
+					t.Fatalf("%d picks succeeded, %d drafts", ok, len(drafts))
+				}
+			})
+		})
+	}
+}
+
+func TestGenSummaryKeepsRunesWhole(t *testing.T) {
+	got := genSummary(Gen{Output: strings.Repeat("é", 70)})
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, "...") {
+		t.Fatalf("summary=%q", got)
+	}
+}
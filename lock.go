@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLockTimeout = 10 * time.Second
+	// lockStaleAfter is far longer than any read-modify-write takes; a lock
+	// file this old was left behind by a process that crashed while holding it.
+	lockStaleAfter = 30 * time.Second
+	lockPoll       = 25 * time.Millisecond
+)
+
+func lockPath() string { return filepath.Join(dataDir(), "store.lock") }
+
+// workerLockPath is held for as long as a worker runs, so a profile never
+// has two workers posting the same schedule.
+func workerLockPath() string { return filepath.Join(dataDir(), "worker.lock") }
+
+// lockTimeout is how long to wait for another process to release the store,
+// overridable with XPOSTCTL_LOCK_TIMEOUT (e.g. "30s").
+func lockTimeout() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("XPOSTCTL_LOCK_TIMEOUT")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return defaultLockTimeout
+}
+
+// withLock runs fn while holding the advisory store lock so concurrent
+// xpostctl processes (a worker, agents, a shell) cannot interleave their
+// read-modify-write cycles and drop each other's records.
+func withLock(fn func() error) error {
+	if err := ensureData(); err != nil {
+		return err
+	}
+	release, err := acquireLock(lockPath(), lockTimeout())
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+func acquireLock(path string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			fmt.Fprintf(f, "%d %s\n", os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+			f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > lockStaleAfter {
+			breakStaleLock(path)
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			holder, _ := os.ReadFile(path)
+			return nil, cliFail("LOCKED", "Tweet store is locked by another xpostctl process", map[string]any{"lockFile": path, "holder": strings.TrimSpace(string(holder)), "waited": timeout.String()})
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// breakStaleLock removes the lock at path if it is still stale. Breakers
+// take path.break first and re-check the lock under it: two processes that
+// both saw the same stale lock would otherwise both remove it, the second
+// one deleting the fresh lock the first one's winner had just created.
+func breakStaleLock(path string) {
+	guard := path + ".break"
+	g, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		// Breaking takes microseconds; a guard this old belongs to a
+		// process that crashed in between.
+		if fi, err := os.Stat(guard); err == nil && time.Since(fi.ModTime()) > lockStaleAfter {
+			_ = os.Remove(guard)
+		}
+		time.Sleep(lockPoll)
+		return
+	}
+	g.Close()
+	defer os.Remove(guard)
+	if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > lockStaleAfter {
+		_ = os.Remove(path)
+	}
+}
+
+// holdLock takes the lock at path for a long-running process without
+// waiting, and keeps touching it so it never looks stale while held.
+func holdLock(path string) (func(), error) {
+	release, err := acquireLock(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		tick := time.NewTicker(lockStaleAfter / 3)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-tick.C:
+				_ = os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		release()
+	}, nil
+}
+
+// lockHeld reports whether a live process holds the lock at path.
+func lockHeld(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && time.Since(fi.ModTime()) <= lockStaleAfter
+}
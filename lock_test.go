@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentCreatesKeepEveryRecord(t *testing.T) {
+	withTempCwd(t, func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := createTweet("x", nil, 0, nil); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		all, _ := listTweets("")
+		if len(all) != 20 {
+			t.Fatalf("len=%d", len(all))
+		}
+	})
+}
+
+func TestLockedStoreReturnsLockedError(t *testing.T) {
+	withTempCwd(t, func() {
+		t.Setenv("XPOSTCTL_LOCK_TIMEOUT", "50ms")
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(lockPath(), []byte("999 held"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := createTweet("x", nil, 0, nil)
+		var ce *CliErr
+		if !errors.As(err, &ce) || ce.Code != "LOCKED" {
+			t.Fatalf("err=%v", err)
+		}
+	})
+}
+
+func TestConcurrentStaleBreakersHoldOneLock(t *testing.T) {
+	withTempCwd(t, func() {
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-2 * lockStaleAfter)
+		stale := func(path string) {
+			if err := os.WriteFile(path, []byte("999 crashed"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A breaker that saw the stale lock before another one replaced it
+		// must leave the fresh lock alone.
+		stale(lockPath())
+		breakStaleLock(lockPath())
+		release, err := acquireLock(lockPath(), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		breakStaleLock(lockPath())
+		if _, err := os.Stat(lockPath()); err != nil {
+			t.Fatalf("late breaker removed the fresh lock: %v", err)
+		}
+		release()
+
+		// Only the guard holder breaks; a crashed breaker's guard expires.
+		stale(lockPath())
+		if err := os.WriteFile(lockPath()+".break", nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		breakStaleLock(lockPath())
+		if _, err := os.Stat(lockPath()); err != nil {
+			t.Fatal("broke the lock without the guard")
+		}
+		stale(lockPath() + ".break")
+		breakStaleLock(lockPath())
+		breakStaleLock(lockPath())
+		if _, err := os.Stat(lockPath()); !os.IsNotExist(err) {
+			t.Fatalf("stale lock kept: %v", err)
+		}
+
+		stale(lockPath())
+		var active, most atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := acquireLock(lockPath(), 10*time.Second)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := active.Add(1)
+				for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+				}
+				time.Sleep(time.Millisecond)
+				active.Add(-1)
+				release()
+			}()
+		}
+		wg.Wait()
+		if n := most.Load(); n != 1 {
+			t.Fatalf("%d holders at once", n)
+		}
+	})
+}
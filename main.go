@@ -9,7 +9,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -21,16 +20,22 @@ import (
 )
 
 const (
-	draftStatus  = "draft"
-	postedStatus = "posted"
-	failedStatus = "failed"
+	draftStatus     = "draft"
+	scheduledStatus = "scheduled"
+	// postingStatus is a tweet the worker has claimed and is publishing.
+	postingStatus = "posting"
+	postedStatus  = "posted"
+	failedStatus  = "failed"
 )
 
 var version = "dev"
 
 const defaultHTTPTimeout = 30 * time.Second
 
-type Ctx struct{ JSON bool }
+type Ctx struct {
+	JSON    bool
+	Profile string
+}
 
 type CliErr struct {
 	Code    string `json:"code"`
@@ -45,15 +50,32 @@ func cliFail(code, msg string, details any) error {
 }
 
 type Tweet struct {
-	ID        string  `json:"id"`
-	Content   string  `json:"content"`
-	ThreadID  *string `json:"thread_id"`
-	ThreadPos int     `json:"thread_pos"`
-	Status    string  `json:"status"`
-	TweetID   *string `json:"tweet_id"`
-	PostedAt  *string `json:"posted_at"`
-	CreatedAt string  `json:"created_at"`
-	Tags      *string `json:"tags"`
+	ID          string    `json:"id"`
+	Content     string    `json:"content"`
+	ThreadID    *string   `json:"thread_id"`
+	ThreadPos   int       `json:"thread_pos"`
+	Status      string    `json:"status"`
+	TweetID     *string   `json:"tweet_id"`
+	PostedAt    *string   `json:"posted_at"`
+	ScheduledAt *string   `json:"scheduled_at"`
+	CreatedAt   string    `json:"created_at"`
+	Tags        *string   `json:"tags"`
+	Media       []Media   `json:"media,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Attempts    []Attempt `json:"attempts,omitempty"`
+	// Profile and Account record where a posted tweet went out from: the
+	// xpostctl profile and, when known, the X username.
+	Profile string `json:"profile,omitempty"`
+	Account string `json:"account,omitempty"`
+	// Flags are problems found when the draft was generated, such as a
+	// phrase from ai.avoid; editing the draft re-checks them. post and
+	// schedule refuse a flagged draft without --force.
+	Flags []string `json:"flags,omitempty"`
+	// FlagsAccepted records schedule --force, so the worker posts the
+	// flagged draft; editing the draft clears it.
+	FlagsAccepted bool `json:"flags_accepted,omitempty"`
+	// GenID is the generation the draft was made from.
+	GenID string `json:"gen_id,omitempty"`
 }
 
 type Gen struct {
@@ -62,6 +84,12 @@ type Gen struct {
 	Output    string `json:"output"`
 	Model     string `json:"model"`
 	CreatedAt string `json:"created_at"`
+	// Mode and Topic describe the request. Variants are set by generate
+	// --variants; Picked holds the 1-based variants that became drafts.
+	Mode     string   `json:"mode,omitempty"`
+	Topic    string   `json:"topic,omitempty"`
+	Variants []string `json:"variants,omitempty"`
+	Picked   []int    `json:"picked,omitempty"`
 }
 
 type Config struct {
@@ -75,7 +103,27 @@ type Config struct {
 		Topics []string `json:"topics"`
 		Tone   string   `json:"tone"`
 		Avoid  []string `json:"avoid"`
+		// Provider is "template" (offline, the default), "openai" or
+		// "ollama"; both of the latter speak the OpenAI chat completions API.
+		Provider    string   `json:"provider,omitempty"`
+		Model       string   `json:"model,omitempty"`
+		BaseURL     string   `json:"baseUrl,omitempty"`
+		APIKey      string   `json:"apiKey,omitempty"`
+		Temperature *float64 `json:"temperature,omitempty"`
 	} `json:"ai"`
+	Store   string `json:"store,omitempty"`
+	APIBase string `json:"apiBase,omitempty"`
+	// Auth forces "oauth1" or "oauth2"; empty picks OAuth 2.0 once logged in.
+	Auth   string `json:"auth,omitempty"`
+	OAuth2 struct {
+		ClientID     string `json:"clientId,omitempty"`
+		ClientSecret string `json:"clientSecret,omitempty"`
+	} `json:"oauth2"`
+	Retry struct {
+		MaxAttempts int `json:"maxAttempts,omitempty"`
+	} `json:"retry"`
+	// Secrets is where auth set keeps the credentials: "keyring" or "file".
+	Secrets string `json:"secrets,omitempty"`
 }
 
 func defaultConfig() Config {
@@ -104,15 +152,29 @@ func defaultDataDir() string {
 	return filepath.Join(root, "xpostctl")
 }
 
-func dataDir() string {
+// dataDir is the active profile's directory: the root data directory for the
+// default profile, root/profiles/<name> for the others.
+func dataDir() string { return profileDir(currentProfile()) }
+
+func rootDir() string {
+	d, _ := dataDirSource()
+	return d
+}
+
+// dataDirSource resolves the root data directory and names the rule that
+// picked it: "env" (XPOSTCTL_DATA_DIR), "legacy" (./.twitter) or "user config".
+func dataDirSource() (string, string) {
 	if p := strings.TrimSpace(os.Getenv("XPOSTCTL_DATA_DIR")); p != "" {
-		return p
+		return p, "env"
 	}
 	legacy := legacyDataDir()
 	if _, err := os.Stat(legacy); err == nil {
-		return legacy
+		return legacy, "legacy"
 	}
-	return defaultDataDir()
+	if d := defaultDataDir(); d != legacy {
+		return d, "user config"
+	}
+	return legacy, "legacy"
 }
 
 func tweetsPath() string { return filepath.Join(dataDir(), "tweets.json") }
@@ -129,134 +191,180 @@ func readJSON[T any](path string, fallback T) (T, error) {
 	if err != nil {
 		return fallback, err
 	}
+	out := fallback
 	if len(bytes.TrimSpace(raw)) == 0 {
+		if recovered, ok := recoverJSON(path, &out); ok {
+			return recovered, nil
+		}
 		return fallback, nil
 	}
-	out := fallback
 	if err := json.Unmarshal(raw, &out); err != nil {
+		out = fallback
+		if recovered, ok := recoverJSON(path, &out); ok {
+			return recovered, nil
+		}
 		return fallback, err
 	}
 	return out, nil
 }
 
+// recoverJSON restores path from its .bak when the main file is empty or
+// unparsable, keeping the damaged copy as .corrupt for inspection.
+func recoverJSON[T any](path string, out *T) (T, bool) {
+	raw, err := os.ReadFile(path + ".bak")
+	if err != nil || len(bytes.TrimSpace(raw)) == 0 {
+		return *out, false
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return *out, false
+	}
+	if bad, err := os.ReadFile(path); err == nil && len(bad) > 0 {
+		_ = os.WriteFile(path+".corrupt", bad, 0o600)
+	}
+	if err := writeFileAtomic(path, raw, 0o600); err == nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s was damaged; restored from %s.bak\n", filepath.Base(path), filepath.Base(path))
+	}
+	return *out, true
+}
+
 func writeJSON(path string, v any) error {
 	raw, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return err
 	}
 	raw = append(raw, '\n')
-	return os.WriteFile(path, raw, 0o600)
+	return writeFileAtomic(path, raw, 0o600)
 }
 
-func listTweets(status string) ([]Tweet, error) {
-	if err := ensureData(); err != nil {
-		return nil, err
+// writeFileAtomic replaces path via a synced temp file and rename, so readers
+// see either the old or the new content, never a torn write. The previous
+// content is kept as path.bak as long as it was valid JSON.
+func writeFileAtomic(path string, raw []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if prev, err := os.ReadFile(path); err == nil && json.Valid(prev) {
+		if err := replaceFile(dir, path+".bak", prev, perm); err != nil {
+			return err
+		}
 	}
-	all, err := readJSON(tweetsPath(), []Tweet{})
+	return replaceFile(dir, path, raw, perm)
+}
+
+func replaceFile(dir, path string, raw []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	out := make([]Tweet, 0, len(all))
-	for _, t := range all {
-		if status == "" || t.Status == status {
-			out = append(out, t)
-		}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return err
 	}
-	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt > out[j].CreatedAt })
-	return out, nil
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
 }
 
-func getTweet(id string) (*Tweet, error) {
-	all, err := listTweets("")
+func listTweets(status string) ([]Tweet, error) {
+	s, err := openStore()
 	if err != nil {
 		return nil, err
 	}
-	for i := range all {
-		if all[i].ID == id {
-			c := all[i]
-			return &c, nil
-		}
-	}
-	return nil, nil
+	return s.ListTweets(status)
 }
 
-func saveAllTweets(items []Tweet) error {
-	if err := ensureData(); err != nil {
-		return err
+func getTweet(id string) (*Tweet, error) {
+	s, err := openStore()
+	if err != nil {
+		return nil, err
 	}
-	return writeJSON(tweetsPath(), items)
+	return s.GetTweet(id)
+}
+
+func newTweet(content string, threadID *string, pos int, tags *string) Tweet {
+	return Tweet{ID: newID(12), Content: content, ThreadID: threadID, ThreadPos: pos, Status: draftStatus, CreatedAt: time.Now().UTC().Format(time.RFC3339), Tags: tags}
 }
 
 func createTweet(content string, threadID *string, pos int, tags *string) (Tweet, error) {
-	all, err := listTweets("")
+	return insertTweet(newTweet(content, threadID, pos, tags))
+}
+
+func insertTweet(t Tweet) (Tweet, error) {
+	s, err := openStore()
 	if err != nil {
 		return Tweet{}, err
 	}
-	t := Tweet{ID: newID(12), Content: content, ThreadID: threadID, ThreadPos: pos, Status: draftStatus, CreatedAt: time.Now().UTC().Format(time.RFC3339), Tags: tags}
-	all = append(all, t)
-	if err := saveAllTweets(all); err != nil {
+	if err := s.PutTweets(t); err != nil {
 		return Tweet{}, err
 	}
 	return t, nil
 }
 
 func updateTweet(id string, fn func(*Tweet)) (*Tweet, error) {
-	all, err := listTweets("")
+	s, err := openStore()
 	if err != nil {
 		return nil, err
 	}
-	for i := range all {
-		if all[i].ID == id {
-			fn(&all[i])
-			if err := saveAllTweets(all); err != nil {
-				return nil, err
-			}
-			c := all[i]
-			return &c, nil
-		}
-	}
-	return nil, nil
+	return s.UpdateTweet(id, fn)
 }
 
 func deleteTweet(id string) error {
-	all, err := listTweets("")
+	s, err := openStore()
 	if err != nil {
 		return err
 	}
-	out := make([]Tweet, 0, len(all))
-	for _, t := range all {
-		if t.ID != id {
-			out = append(out, t)
-		}
-	}
-	return saveAllTweets(out)
+	return s.DeleteTweet(id)
 }
 
 func threadTweets(id string) ([]Tweet, error) {
-	all, err := listTweets("")
+	s, err := openStore()
 	if err != nil {
 		return nil, err
 	}
-	out := []Tweet{}
-	for _, t := range all {
-		if t.ThreadID != nil && *t.ThreadID == id {
-			out = append(out, t)
-		}
+	return s.ThreadTweets(id)
+}
+
+func saveGen(g Gen) (Gen, error) {
+	s, err := openStore()
+	if err != nil {
+		return g, err
 	}
-	sort.Slice(out, func(i, j int) bool { return out[i].ThreadPos < out[j].ThreadPos })
-	return out, nil
+	if g.ID == "" {
+		g.ID, g.CreatedAt = newID(12), time.Now().UTC().Format(time.RFC3339)
+	}
+	return g, s.PutGens(g)
 }
 
-func saveGen(prompt, output, model string) error {
-	if err := ensureData(); err != nil {
-		return err
+func getGen(id string) (*Gen, error) {
+	s, err := openStore()
+	if err != nil {
+		return nil, err
 	}
-	all, err := readJSON(gensPath(), []Gen{})
+	gens, err := s.ListGens()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for _, g := range gens {
+		if g.ID == id {
+			return &g, nil
+		}
 	}
-	all = append(all, Gen{ID: newID(12), Prompt: prompt, Output: output, Model: model, CreatedAt: time.Now().UTC().Format(time.RFC3339)})
-	return writeJSON(gensPath(), all)
+	return nil, nil
 }
 
 func parseDotEnv(raw string) map[string]string {
@@ -280,6 +388,10 @@ func parseDotEnv(raw string) map[string]string {
 	return out
 }
 
+// envFileVars records which env file set each variable loadEnvFile exported,
+// so doctor can tell them apart from the real environment.
+var envFileVars = map[string]string{}
+
 func loadEnvFile(path string) {
 	raw, err := os.ReadFile(path)
 	if err != nil {
@@ -288,40 +400,131 @@ func loadEnvFile(path string) {
 	for k, v := range parseDotEnv(string(raw)) {
 		if os.Getenv(k) == "" {
 			_ = os.Setenv(k, v)
+			envFileVars[k] = path
 		}
 	}
 }
 
+// credVar is a credential loadConfig resolves: the config.json value,
+// overridden by the secret store (auth set), overridden by the first of env
+// that is set. Account credentials belong to one X account, so outside the
+// default profile they only come from that profile's own variables.
+type credVar struct {
+	Key     string
+	Env     []string
+	Account bool
+	field   func(*Config) *string
+}
+
+var credVars = []credVar{
+	{"twitter.apiKey", []string{"X_API_KEY", "TWITTER_API_KEY"}, true, func(c *Config) *string { return &c.Twitter.APIKey }},
+	{"twitter.apiSecret", []string{"X_API_SECRET", "TWITTER_API_SECRET"}, true, func(c *Config) *string { return &c.Twitter.APISecret }},
+	{"twitter.accessToken", []string{"X_ACCESS_TOKEN", "TWITTER_ACCESS_TOKEN"}, true, func(c *Config) *string { return &c.Twitter.AccessToken }},
+	{"twitter.accessSecret", []string{"X_ACCESS_SECRET", "TWITTER_ACCESS_SECRET"}, true, func(c *Config) *string { return &c.Twitter.AccessSecret }},
+	{"oauth2.clientId", []string{"X_CLIENT_ID"}, true, func(c *Config) *string { return &c.OAuth2.ClientID }},
+	{"oauth2.clientSecret", []string{"X_CLIENT_SECRET"}, true, func(c *Config) *string { return &c.OAuth2.ClientSecret }},
+	{"ai.apiKey", []string{"XPOSTCTL_AI_API_KEY", "OPENAI_API_KEY"}, false, func(c *Config) *string { return &c.AI.APIKey }},
+}
+
+// profileEnv is the variable that sets name for one profile only:
+// XPOSTCTL_ACME_X_API_KEY for X_API_KEY in profile acme.
+func profileEnv(profile, name string) string {
+	return "XPOSTCTL_" + strings.ToUpper(strings.ReplaceAll(profile, "-", "_")) + "_" + name
+}
+
+// envNames are the variables v is read from in the current profile.
+func (v credVar) envNames() []string {
+	p := currentProfile()
+	if !v.Account || p == defaultProfile {
+		return v.Env
+	}
+	out := make([]string, len(v.Env))
+	for i, e := range v.Env {
+		out[i] = profileEnv(p, e)
+	}
+	return out
+}
+
+// envOverride returns the first of v's variables that is set and its value.
+func (v credVar) envOverride() (string, string) {
+	for _, k := range v.envNames() {
+		if x := os.Getenv(k); x != "" {
+			return k, x
+		}
+	}
+	return "", ""
+}
+
+// ignoredEnv returns the first of v.Env that is set but does not apply to
+// the current profile, so doctor can say why it has no effect.
+func (v credVar) ignoredEnv() string {
+	if !v.Account || currentProfile() == defaultProfile {
+		return ""
+	}
+	for _, k := range v.Env {
+		if os.Getenv(k) != "" {
+			return k
+		}
+	}
+	return ""
+}
+
 func loadConfig() (Config, error) {
-	if err := ensureData(); err != nil {
+	cfg, ok, err := readConfig()
+	if err != nil {
+		return Config{}, err
+	}
+	if !ok {
+		if s, err := openStore(); err == nil {
+			_ = s.SaveConfig(cfg)
+		}
+	}
+	secrets, err := storedSecrets(cfg.Secrets)
+	if err != nil {
 		return Config{}, err
 	}
+	return withCredentials(cfg, secrets), nil
+}
+
+// readConfig loads the env files and the stored config without writing
+// anything; ok is false when there is no config yet.
+func readConfig() (Config, bool, error) {
+	if err := ensureData(); err != nil {
+		return Config{}, false, err
+	}
 	if p := os.Getenv("XPOSTCTL_ENV_FILE"); p != "" {
 		loadEnvFile(p)
 	}
 	loadEnvFile(filepath.Join(cwd(), "x.env"))
-	cfg := defaultConfig()
-	raw, err := os.ReadFile(cfgPath())
-	if errors.Is(err, os.ErrNotExist) {
-		_ = writeJSON(cfgPath(), cfg)
-	} else if err == nil {
-		_ = json.Unmarshal(raw, &cfg)
-	} else {
-		return Config{}, err
-	}
-	if v := first(os.Getenv("X_API_KEY"), os.Getenv("TWITTER_API_KEY")); v != "" {
-		cfg.Twitter.APIKey = v
+	s, err := openStore()
+	if err != nil {
+		return Config{}, false, err
 	}
-	if v := first(os.Getenv("X_API_SECRET"), os.Getenv("TWITTER_API_SECRET")); v != "" {
-		cfg.Twitter.APISecret = v
+	return s.LoadConfig(defaultConfig())
+}
+
+// withCredentials lays the stored secrets and then the env over cfg.
+func withCredentials(cfg Config, secrets map[string]string) Config {
+	for _, v := range credVars {
+		if x := secrets[v.Key]; x != "" {
+			*v.field(&cfg) = x
+		}
 	}
-	if v := first(os.Getenv("X_ACCESS_TOKEN"), os.Getenv("TWITTER_ACCESS_TOKEN")); v != "" {
-		cfg.Twitter.AccessToken = v
+	for _, v := range credVars {
+		if _, x := v.envOverride(); x != "" {
+			*v.field(&cfg) = x
+		}
 	}
-	if v := first(os.Getenv("X_ACCESS_SECRET"), os.Getenv("TWITTER_ACCESS_SECRET")); v != "" {
-		cfg.Twitter.AccessSecret = v
+	return cfg
+}
+
+func hasFlag(args []string, flag string) bool {
+	for _, a := range args {
+		if a == flag {
+			return true
+		}
 	}
-	return cfg, nil
+	return false
 }
 
 func first(v ...string) string {
@@ -403,9 +606,28 @@ func sign(method, rawURL string, c oauthCreds, body map[string]string, nonce, ts
 }
 
 type twClient struct {
-	creds oauthCreds
-	dry   bool
-	quiet bool
+	creds       oauthCreds
+	dry         bool
+	quiet       bool
+	maxAttempts int
+	base        string
+	// timeout, when set, bounds each request below xHTTPClient's timeout.
+	timeout time.Duration
+	// oauth2 is set when requests use an OAuth 2.0 Bearer token from auth
+	// login instead of OAuth 1.0a signatures.
+	oauth2 *oauth2App
+}
+
+const defaultAPIBase = "https://api.x.com"
+
+// apiBase is the X API root: config apiBase, overridden by XPOSTCTL_API_BASE.
+// Point it at `xpostctl dev fake-server` to test without touching X.
+func apiBase(cfg Config) string {
+	return strings.TrimRight(first(strings.TrimSpace(os.Getenv("XPOSTCTL_API_BASE")), cfg.APIBase, defaultAPIBase), "/")
+}
+
+func (c twClient) url(path string) string {
+	return first(c.base, defaultAPIBase) + path
 }
 
 var xHTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
@@ -415,38 +637,37 @@ type postResult struct {
 	Text string `json:"text"`
 }
 
-func (c twClient) post(text string, replyTo *string) (postResult, error) {
+func (c twClient) post(text string, replyTo *string, mediaIDs []string) (postResult, error) {
 	if c.dry {
 		if !c.quiet {
 			fmt.Println("  [dry-run] Would post:", strconv.Quote(text))
 		}
 		return postResult{ID: fmt.Sprintf("dry_%d", time.Now().UnixMilli()), Text: text}, nil
 	}
-	u := "https://api.x.com/2/tweets"
+	u := c.url("/2/tweets")
 	body := map[string]any{"text": text}
 	if replyTo != nil {
 		body["reply"] = map[string]string{"in_reply_to_tweet_id": *replyTo}
 	}
-	raw, _ := json.Marshal(body)
-	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(raw))
-	if err != nil {
-		return postResult{}, err
+	if len(mediaIDs) > 0 {
+		body["media"] = map[string]any{"media_ids": mediaIDs}
 	}
-	req.Header.Set("Authorization", sign("POST", u, c.creds, nil, "", ""))
-	req.Header.Set("Content-Type", "application/json")
-	res, err := xHTTPClient.Do(req)
+	raw, _ := json.Marshal(body)
+	b, err := c.sendCreate(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, c.authorize(req, nil)
+	})
 	if err != nil {
 		return postResult{}, err
 	}
-	defer res.Body.Close()
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		b, _ := io.ReadAll(res.Body)
-		return postResult{}, fmt.Errorf("Twitter API error %d: %s", res.StatusCode, strings.TrimSpace(string(b)))
-	}
 	var out struct {
 		Data postResult `json:"data"`
 	}
-	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+	if err := json.Unmarshal(b, &out); err != nil {
 		return postResult{}, err
 	}
 	return out.Data, nil
@@ -459,25 +680,26 @@ func (c twClient) del(tweetID string) error {
 		}
 		return nil
 	}
-	u := "https://api.x.com/2/tweets/" + tweetID
-	req, err := http.NewRequest(http.MethodDelete, u, nil)
+	u := c.url("/2/tweets/" + url.PathEscape(tweetID))
+	_, err := c.send(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodDelete, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, c.authorize(req, nil)
+	})
+	return err
+}
+
+func draftCmd(args []string, ctx Ctx) (any, error) {
+	args, specs, err := splitMediaArgs(args)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req.Header.Set("Authorization", sign("DELETE", u, c.creds, nil, "", ""))
-	res, err := xHTTPClient.Do(req)
+	media, err := loadMedia(specs)
 	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		b, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("Twitter API error %d: %s", res.StatusCode, strings.TrimSpace(string(b)))
+		return nil, err
 	}
-	return nil
-}
-
-func draftCmd(args []string, ctx Ctx) (any, error) {
 	if len(args) > 0 && args[0] == "--edit" {
 		if len(args) < 3 {
 			return nil, cliFail("INVALID_ARGS", "Usage: tweet draft --edit <id> <new text>", nil)
@@ -494,14 +716,25 @@ func draftCmd(args []string, ctx Ctx) (any, error) {
 		if t.Status != draftStatus {
 			return nil, cliFail("CONFLICT", "Can only edit drafts (current status: "+t.Status+")", nil)
 		}
-		var warning string
-		if len(text) > 280 {
-			warning = fmt.Sprintf("text is %d chars (max 280)", len(text))
-			if !ctx.JSON {
-				fmt.Println("  Warning:", warning)
+		warning := lengthWarning(text)
+		if warning != "" && !ctx.JSON {
+			fmt.Println("  Warning:", warning)
+		}
+		var flags []string
+		if len(t.Flags) > 0 {
+			cfg, err := loadConfig()
+			if err != nil {
+				return nil, err
 			}
+			flags = avoidFlags(avoidHits(text, cfg.AI.Avoid))
 		}
-		up, err := updateTweet(id, func(tt *Tweet) { tt.Content = text })
+		up, err := updateTweet(id, func(tt *Tweet) {
+			tt.Content = text
+			tt.Flags, tt.FlagsAccepted = flags, false
+			if len(media) > 0 {
+				tt.Media = media
+			}
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -530,24 +763,44 @@ func draftCmd(args []string, ctx Ctx) (any, error) {
 		}
 		return map[string]any{"action": "deleted", "id": id}, nil
 	}
-	text := strings.TrimSpace(strings.Join(args, " "))
+	thread, number := false, false
+	rest := []string{}
+	for _, a := range args {
+		switch a {
+		case "--thread":
+			thread = true
+		case "--number":
+			number = true
+		default:
+			rest = append(rest, a)
+		}
+	}
+	text := strings.TrimSpace(strings.Join(rest, " "))
 	if text == "" {
-		return nil, cliFail("INVALID_ARGS", "Usage: tweet draft <text>", map[string]any{"examples": []string{"tweet draft --edit <id> <new text>"}})
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet draft <text> [--media <path> [--alt <text>]]...", map[string]any{"examples": []string{"tweet draft --edit <id> <new text>", "tweet draft --thread [--number] <long text>", "tweet draft \"Look\" --media shot.png --alt \"Dashboard showing p95 latency\""}})
 	}
-	var warning string
-	if len(text) > 280 {
-		warning = fmt.Sprintf("text is %d chars (max 280)", len(text))
-		if !ctx.JSON {
-			fmt.Println("  Warning:", warning)
-		}
+	if thread {
+		return draftThreadCmd(text, number, media, ctx)
 	}
-	tw, err := createTweet(text, nil, 0, nil)
+	warning := lengthWarning(text)
+	if warning != "" && !ctx.JSON {
+		fmt.Println("  Warning:", warning)
+	}
+	tw := newTweet(text, nil, 0, nil)
+	tw.Media = media
+	tw, err = insertTweet(tw)
 	if err != nil {
 		return nil, err
 	}
 	if !ctx.JSON {
 		fmt.Println("  Created draft", tw.ID)
 		fmt.Println(" ", tw.Content)
+		for _, m := range tw.Media {
+			fmt.Printf("  + %s (%s, %d bytes)\n", filepath.Base(m.Path), m.Kind, m.Size)
+			if m.Alt == "" && m.Kind != videoKind {
+				fmt.Println("    Warning: no alt text")
+			}
+		}
 	}
 	return map[string]any{"action": "created", "tweet": tw, "warning": nilIfEmpty(warning)}, nil
 }
@@ -565,9 +818,9 @@ func listCmd(args []string, ctx Ctx) (any, error) {
 		f = args[0]
 	}
 	if f != "" {
-		ok := map[string]bool{"draft": true, "drafts": true, "posted": true, "failed": true}
+		ok := map[string]bool{"draft": true, "drafts": true, "scheduled": true, "posting": true, "posted": true, "failed": true}
 		if !ok[f] {
-			return nil, cliFail("INVALID_ARGS", "Invalid filter: "+f, map[string]any{"validFilters": []string{"drafts", "posted", "failed"}})
+			return nil, cliFail("INVALID_ARGS", "Invalid filter: "+f, map[string]any{"validFilters": []string{"drafts", "scheduled", "posting", "posted", "failed"}})
 		}
 	}
 	s := f
@@ -593,6 +846,12 @@ func listCmd(args []string, ctx Ctx) (any, error) {
 					p = p[:60] + "..."
 				}
 				fmt.Printf("  %s [%s] %s\n", t.ID, t.Status, p)
+				if t.Status == failedStatus && t.Error != "" {
+					fmt.Println("    error:", t.Error)
+				}
+				if len(t.Flags) > 0 {
+					fmt.Println("    flagged:", strings.Join(t.Flags, ", "))
+				}
 			}
 			fmt.Println()
 		}
@@ -621,10 +880,34 @@ func getCmd(args []string, ctx Ctx) (any, error) {
 		if t.TweetID != nil {
 			fmt.Println("  tweet_id:", *t.TweetID)
 		}
+		for _, m := range t.Media {
+			fmt.Printf("  media: %s (%s, %d bytes)\n", m.Path, m.Kind, m.Size)
+			if m.Alt != "" {
+				fmt.Println("    alt:", m.Alt)
+			}
+		}
 		fmt.Println("  created:", t.CreatedAt)
+		if t.ScheduledAt != nil {
+			fmt.Println("  scheduled:", *t.ScheduledAt)
+		}
 		if t.PostedAt != nil {
 			fmt.Println("  posted:", *t.PostedAt)
 		}
+		if t.Profile != "" {
+			fmt.Println("  from:", describeAccount(t.Profile, t.Account))
+		}
+		if t.GenID != "" {
+			fmt.Println("  generation:", t.GenID)
+		}
+		for _, f := range t.Flags {
+			fmt.Println("  flagged:", f)
+		}
+		if t.Error != "" {
+			fmt.Println("  error:", t.Error)
+		}
+		for _, a := range t.Attempts {
+			fmt.Println("  attempt:", describeAttempt(a))
+		}
 		fmt.Println()
 	}
 	return map[string]any{"tweet": t}, nil
@@ -635,19 +918,32 @@ func postCmd(args []string, ctx Ctx) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	dry := false
+	dry, force := false, false
+	opts := postOpts{}
 	id := ""
 	for _, a := range args {
 		if a == "--dry" {
 			dry = true
 			continue
 		}
+		if a == "--require-alt" {
+			opts.RequireAlt = true
+			continue
+		}
+		if a == "--resume" {
+			opts.Resume = true
+			continue
+		}
+		if a == "--force" {
+			force = true
+			continue
+		}
 		if !strings.HasPrefix(a, "--") && id == "" {
 			id = a
 		}
 	}
 	if id == "" {
-		return nil, cliFail("INVALID_ARGS", "Usage: tweet post <id> [--dry]", nil)
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet post <id> [--dry] [--require-alt] [--resume] [--force]", nil)
 	}
 	t, err := getTweet(id)
 	if err != nil {
@@ -656,56 +952,159 @@ func postCmd(args []string, ctx Ctx) (any, error) {
 	if t == nil {
 		return nil, cliFail("NOT_FOUND", "Tweet not found: "+id, nil)
 	}
-	if t.Status == postedStatus {
-		tid := ""
-		if t.TweetID != nil {
-			tid = *t.TweetID
+	if t.Status == postedStatus && t.ThreadID == nil {
+		return nil, cliFail("CONFLICT", "Already posted (tweet ID: "+deref(t.TweetID)+")", nil)
+	}
+	members, err := scheduleTargets(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := inFlight(members); err != nil {
+		return nil, err
+	}
+	if !force {
+		if err := flaggedIn(members, "post"); err != nil {
+			return nil, err
+		}
+	}
+	return publish(newClient(cfg, dry, ctx.JSON), t, opts, ctx)
+}
+
+type postOpts struct {
+	// RequireAlt turns the missing-alt-text lint into an error.
+	RequireAlt bool
+	// Resume continues a partially posted thread after its last posted
+	// member instead of refusing it.
+	Resume bool
+}
+
+// flaggedIn refuses members that are unposted, flagged drafts; cmd is the
+// command to repeat with --force.
+func flaggedIn(members []Tweet, cmd string) error {
+	for _, m := range members {
+		if len(m.Flags) > 0 && m.Status != postedStatus {
+			return cliFail("FLAGGED", "Draft "+m.ID+" is flagged: "+strings.Join(m.Flags, ", "), map[string]any{"id": m.ID, "flags": m.Flags, "hint": "rewrite it with `tweet draft --edit " + m.ID + " <text>`, or pass --force to " + cmd + " it anyway"})
 		}
-		return nil, cliFail("CONFLICT", "Already posted (tweet ID: "+tid+")", nil)
 	}
-	c := twClient{creds: oauthCreds{APIKey: cfg.Twitter.APIKey, APISecret: cfg.Twitter.APISecret, AccessToken: cfg.Twitter.AccessToken, AccessSecret: cfg.Twitter.AccessSecret}, dry: dry, quiet: ctx.JSON}
+	return nil
+}
+
+func newClient(cfg Config, dry, quiet bool) twClient {
+	c := twClient{creds: oauthCreds{APIKey: cfg.Twitter.APIKey, APISecret: cfg.Twitter.APISecret, AccessToken: cfg.Twitter.AccessToken, AccessSecret: cfg.Twitter.AccessSecret}, dry: dry, quiet: quiet, maxAttempts: maxAttempts(cfg), base: apiBase(cfg)}
+	if authMode(cfg) == "oauth2" {
+		app := newOAuth2App(cfg)
+		c.oauth2 = &app
+	}
+	return c
+}
+
+// threadPostDelay spaces out the replies of a thread so X does not treat
+// them as a burst.
+var threadPostDelay = 1500 * time.Millisecond
+
+// publish posts t, or the whole thread it belongs to, and records the result
+// in the store. It is shared by the post command and the worker.
+func publish(c twClient, t *Tweet, opts postOpts, ctx Ctx) (map[string]any, error) {
+	dry := c.dry
+	members := []Tweet{*t}
 	if t.ThreadID != nil {
 		thr, err := threadTweets(*t.ThreadID)
 		if err != nil {
 			return nil, err
 		}
-		if !ctx.JSON {
-			fmt.Printf("  Posting thread (%d tweets)...\n", len(thr))
-		}
+		members = thr
+	}
+	warnings, err := lintAlt(members, opts.RequireAlt, ctx)
+	if err != nil {
+		return nil, err
+	}
+	profile, account := currentProfile(), c.account()
+	if t.ThreadID != nil {
+		thr := members
+		done := 0
 		var last *string
 		for _, it := range thr {
-			r, err := c.post(it.Content, last)
-			if err != nil {
+			if it.Status == postedStatus {
+				done++
+				last = it.TweetID
+			}
+		}
+		if done == len(thr) {
+			return nil, cliFail("CONFLICT", "Thread already posted", map[string]any{"threadId": *t.ThreadID, "count": done})
+		}
+		if done > 0 && !opts.Resume {
+			return nil, cliFail("CONFLICT", fmt.Sprintf("Thread is partially posted (%d/%d); use --resume to continue", done, len(thr)), map[string]any{"threadId": *t.ThreadID, "posted": done, "count": len(thr), "hint": "tweet post " + t.ID + " --resume"})
+		}
+		media := make([][]Media, len(thr))
+		for i, it := range thr {
+			if it.Status == postedStatus {
+				continue
+			}
+			if media[i], err = refreshMedia(it.Media); err != nil {
 				return nil, err
 			}
+		}
+		if !ctx.JSON {
+			if done > 0 {
+				fmt.Printf("  Resuming thread at %d/%d...\n", done+1, len(thr))
+			} else {
+				fmt.Printf("  Posting thread (%d tweets)...\n", len(thr))
+			}
+		}
+		for i, it := range thr {
+			if it.Status == postedStatus {
+				continue
+			}
+			r, err := c.postWithMedia(it.Content, last, media[i])
+			if err != nil {
+				msg := err.Error()
+				_, _ = updateTweet(it.ID, func(tt *Tweet) {
+					tt.Status = failedStatus
+					recordAttempt(tt, err, dry)
+				})
+				return nil, apiFail("POST_FAILED", fmt.Sprintf("Thread stopped at %d/%d: %s", i+1, len(thr), msg), err, map[string]any{"id": it.ID, "threadId": *t.ThreadID, "position": i + 1, "posted": done, "count": len(thr), "hint": "tweet post " + t.ID + " --resume"})
+			}
 			rid := r.ID
 			_, _ = updateTweet(it.ID, func(tt *Tweet) {
 				tt.Status = postedStatus
 				tt.TweetID = &rid
 				ts := time.Now().UTC().Format(time.RFC3339)
 				tt.PostedAt = &ts
+				tt.Profile, tt.Account = profile, account
+				recordAttempt(tt, nil, dry)
 			})
 			last = &rid
-			if !dry {
-				time.Sleep(1500 * time.Millisecond)
+			done++
+			if !dry && done < len(thr) {
+				time.Sleep(threadPostDelay)
 			}
 		}
 		upd, _ := threadTweets(*t.ThreadID)
 		if !ctx.JSON {
 			fmt.Printf("  Thread posted (%d tweets)\n", len(upd))
 		}
-		return map[string]any{"mode": "thread", "dryRun": dry, "count": len(upd), "tweets": upd}, nil
+		return map[string]any{"mode": "thread", "dryRun": dry, "count": len(upd), "tweets": upd, "warnings": warnings}, nil
+	}
+	media, err := refreshMedia(t.Media)
+	if err != nil {
+		return nil, err
 	}
-	r, err := c.post(t.Content, nil)
+	r, err := c.postWithMedia(t.Content, nil, media)
 	if err != nil {
-		_, _ = updateTweet(t.ID, func(tt *Tweet) { tt.Status = failedStatus })
-		return nil, cliFail("POST_FAILED", "Failed: "+err.Error(), map[string]any{"id": t.ID})
+		msg := err.Error()
+		_, _ = updateTweet(t.ID, func(tt *Tweet) {
+			tt.Status = failedStatus
+			recordAttempt(tt, err, dry)
+		})
+		return nil, apiFail("POST_FAILED", "Failed: "+msg, err, map[string]any{"id": t.ID})
 	}
 	upd, err := updateTweet(t.ID, func(tt *Tweet) {
 		tt.Status = postedStatus
 		tt.TweetID = &r.ID
 		ts := time.Now().UTC().Format(time.RFC3339)
 		tt.PostedAt = &ts
+		tt.Profile, tt.Account = profile, account
+		recordAttempt(tt, nil, dry)
 	})
 	if err != nil {
 		return nil, err
@@ -713,7 +1112,7 @@ func postCmd(args []string, ctx Ctx) (any, error) {
 	if !ctx.JSON {
 		fmt.Printf("  Posted %s -> %s\n", t.ID, r.ID)
 	}
-	return map[string]any{"mode": "single", "dryRun": dry, "tweet": upd, "post": r}, nil
+	return map[string]any{"mode": "single", "dryRun": dry, "tweet": upd, "post": r, "warnings": warnings}, nil
 }
 
 func deleteCmd(args []string, ctx Ctx) (any, error) {
@@ -744,9 +1143,9 @@ func deleteCmd(args []string, ctx Ctx) (any, error) {
 	}
 	remote := false
 	if t.TweetID != nil && *t.TweetID != "" {
-		c := twClient{creds: oauthCreds{APIKey: cfg.Twitter.APIKey, APISecret: cfg.Twitter.APISecret, AccessToken: cfg.Twitter.AccessToken, AccessSecret: cfg.Twitter.AccessSecret}, dry: dry, quiet: ctx.JSON}
+		c := newClient(cfg, dry, ctx.JSON)
 		if err := c.del(*t.TweetID); err != nil {
-			return nil, err
+			return nil, apiFail("DELETE_FAILED", "Failed to delete "+*t.TweetID+": "+err.Error(), err, map[string]any{"id": t.ID, "tweetId": *t.TweetID})
 		}
 		remote = true
 	}
@@ -763,106 +1162,43 @@ func deleteCmd(args []string, ctx Ctx) (any, error) {
 	return map[string]any{"id": t.ID, "status": t.Status, "dryRun": dry, "remoteDeleted": remote, "remoteTweetId": t.TweetID}, nil
 }
 
-func genTemplate(mode, topic string) string {
-	switch mode {
-	case "ideas":
-		return "1. Share one unpopular engineering tradeoff you changed your mind on.\n2. A small automation that saves your team 30 minutes daily.\n3. Why most dashboards hide the metric that matters.\n4. [THREAD] A real incident timeline and what you fixed first.\n5. A code review habit that reduced bugs in your team.\n6. How you scope features to fit one sprint.\n7. [THREAD] Lessons from replacing a legacy dependency.\n8. A practical AI workflow that actually helps coding speed.\n9. One dev-tool configuration most teams forget.\n10. What you would delete from your stack today and why."
-	case "thread":
-		return fmt.Sprintf("Most teams overcomplicate %s. Here is the lean approach that ships.\n---\n1) Set a single success metric before writing code.\n---\n2) Build the smallest path to prove the metric in prod.\n---\n3) Remove abstractions until pain appears, then add one layer.\n---\n4) Document tradeoffs and revisit in two weeks with real data.", topic)
-	default:
-		msg := fmt.Sprintf("Most wins in %s come from reducing cycle time, not adding complexity. Short feedback loops beat perfect architecture.", topic)
-		if len(msg) > 280 {
-			msg = msg[:280]
-		}
-		return msg
-	}
-}
-
-func generateCmd(args []string, ctx Ctx) (any, error) {
-	if len(args) == 0 {
-		return nil, cliFail("INVALID_ARGS", "Usage: tweet generate <topic>", map[string]any{"examples": []string{"tweet generate thread <topic>", "tweet generate ideas"}})
-	}
-	if args[0] == "ideas" {
-		raw := genTemplate("ideas", "")
-		_ = saveGen("Generate 10 tweet ideas for this week.", raw, "template")
-		if !ctx.JSON {
-			fmt.Println()
-			fmt.Println(raw)
-			fmt.Println()
-		}
-		return map[string]any{"mode": "ideas", "raw": raw}, nil
-	}
-	if args[0] == "thread" {
-		topic := strings.TrimSpace(strings.Join(args[1:], " "))
-		if topic == "" {
-			return nil, cliFail("INVALID_ARGS", "Usage: tweet generate thread <topic>", nil)
-		}
-		if !ctx.JSON {
-			fmt.Println("  Generating thread about:", topic)
-		}
-		raw := genTemplate("thread", topic)
-		_ = saveGen("Write a thread about: "+topic, raw, "template")
-		parts := strings.Split(raw, "\n---\n")
-		tid := newID(12)
-		out := []Tweet{}
-		for i, p := range parts {
-			p = strings.TrimSpace(p)
-			if p == "" {
-				continue
-			}
-			if len(p) > 280 {
-				p = p[:280]
-			}
-			th := tid
-			tg := topic
-			tw, err := createTweet(p, &th, i, &tg)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, tw)
-			if !ctx.JSON {
-				fmt.Printf("  [%d] %s\n", i+1, p)
-			}
-		}
-		return map[string]any{"mode": "thread", "topic": topic, "tweets": out, "raw": raw}, nil
-	}
-	topic := strings.TrimSpace(strings.Join(args, " "))
-	raw := genTemplate("single", topic)
-	_ = saveGen("Write a tweet about: "+topic, raw, "template")
-	tg := topic
-	tw, err := createTweet(raw, nil, 0, &tg)
-	if err != nil {
-		return nil, err
-	}
-	if !ctx.JSON {
-		fmt.Println("  Generated", tw.ID)
-		fmt.Println(" ", tw.Content)
-	}
-	return map[string]any{"mode": "single", "topic": topic, "tweets": []Tweet{tw}, "raw": raw}, nil
-}
-
 var cmdHelp = map[string]string{
-	"draft":    "Create, edit, or delete a local draft",
-	"generate": "Generate tweet(s) about a topic",
-	"post":     "Post a draft immediately",
-	"list":     "List tweets by status",
-	"get":      "Get one tweet by local id",
-	"delete":   "Delete a tweet by local id (and remote if posted)",
+	"draft":       "Create, edit, or delete a local draft",
+	"generate":    "Generate tweet(s) about a topic",
+	"generations": "Browse, search, prune or redraft generation history",
+	"post":        "Post a draft immediately",
+	"schedule":    "Schedule a draft (or thread) for later, list or cancel",
+	"worker":      "Run in the foreground and post scheduled tweets when due",
+	"status":      "Show worker liveness and the next scheduled post",
+	"store":       "Show the storage backend or migrate data between backends",
+	"list":        "List tweets by status",
+	"get":         "Get one tweet by local id",
+	"delete":      "Delete a tweet by local id (and remote if posted)",
+	"thread":      "Create, reorder, join, split or show threads",
+	"count":       "Show the weighted length X counts for a text",
+	"prompt":      "List, show, edit or reset generation prompt templates",
+	"auth":        "Log in with OAuth 2.0 (PKCE), log out, or check credentials",
+	"doctor":      "Check the data dir, credential sources and file permissions",
+	"profile":     "List, add, remove or switch account profiles",
+	"dev":         "Developer tools: run a fake X API server for offline testing",
 }
 
+var cmdOrder = []string{"draft", "generate", "generations", "post", "schedule", "worker", "status", "list", "get", "delete", "thread", "count", "prompt", "store", "auth", "doctor", "profile", "dev"}
+
 func help() {
 	fmt.Println()
 	fmt.Println("  xpostctl - X Posting Toolkit")
 	fmt.Println()
-	for _, c := range []string{"draft", "generate", "post", "list", "get", "delete"} {
+	for _, c := range cmdOrder {
 		fmt.Printf("  xpostctl %-17s %s\n", c, cmdHelp[c])
 	}
-	fmt.Println("\n  Global flags:\n    --json   machine-readable output")
+	fmt.Println("\n  Global flags:\n    --json            machine-readable output\n    --profile <name>  use another account's credentials and store")
 	fmt.Println("\n  Examples:")
 	fmt.Println("    xpostctl draft \"My first tweet\"")
 	fmt.Println("    xpostctl generate \"bun runtime\"")
 	fmt.Println("    xpostctl list drafts --json")
 	fmt.Println("    xpostctl post abc123 --dry")
+	fmt.Println("    xpostctl schedule abc123 --at \"tomorrow 9am\"")
 	fmt.Println("    xpostctl get abc123 --json")
 	fmt.Println()
 }
@@ -888,10 +1224,16 @@ func emitJSON(v any) error {
 func parseArgs(argv []string) (string, []string, Ctx) {
 	ctx := Ctx{}
 	out := []string{}
-	for _, a := range argv {
-		if a == "--json" {
+	for i := 0; i < len(argv); i++ {
+		switch a := argv[i]; {
+		case a == "--json":
 			ctx.JSON = true
-		} else {
+		case a == "--profile" && i+1 < len(argv):
+			ctx.Profile = argv[i+1]
+			i++
+		case strings.HasPrefix(a, "--profile="):
+			ctx.Profile = strings.TrimPrefix(a, "--profile=")
+		default:
 			out = append(out, a)
 		}
 	}
@@ -902,21 +1244,50 @@ func parseArgs(argv []string) (string, []string, Ctx) {
 }
 
 func run(cmd string, args []string, ctx Ctx) (any, error) {
+	if cmd != "profile" {
+		if err := requireProfile(); err != nil {
+			return nil, err
+		}
+	}
 	switch cmd {
 	case "draft":
 		return draftCmd(args, ctx)
 	case "generate":
 		return generateCmd(args, ctx)
+	case "generations":
+		return generationsCmd(args, ctx)
 	case "post":
 		return postCmd(args, ctx)
+	case "schedule":
+		return scheduleCmd(args, ctx)
+	case "worker":
+		return workerCmd(args, ctx)
+	case "status":
+		return statusCmd(args, ctx)
+	case "store":
+		return storeCmd(args, ctx)
 	case "list":
 		return listCmd(args, ctx)
 	case "get":
 		return getCmd(args, ctx)
 	case "delete":
 		return deleteCmd(args, ctx)
+	case "thread":
+		return threadCmd(args, ctx)
+	case "count":
+		return countCmd(args, ctx)
+	case "prompt":
+		return promptCmd(args, ctx)
+	case "auth":
+		return authCmd(args, ctx)
+	case "doctor":
+		return doctorCmd(args, ctx)
+	case "profile":
+		return profileCmd(args, ctx)
+	case "dev":
+		return devCmd(args, ctx)
 	default:
-		return nil, cliFail("INVALID_COMMAND", "Unknown command: "+cmd, map[string]any{"command": cmd, "available": []string{"draft", "generate", "post", "list", "get", "delete"}})
+		return nil, cliFail("INVALID_COMMAND", "Unknown command: "+cmd, map[string]any{"command": cmd, "available": cmdOrder})
 	}
 }
 
@@ -930,7 +1301,11 @@ func main() {
 		}
 		return
 	}
+	if ctx.Profile != "" {
+		_ = os.Setenv("XPOSTCTL_PROFILE", ctx.Profile)
+	}
 	data, err := run(cmd, args, ctx)
+	closeStores()
 	if err != nil {
 		if ce, ok := err.(*CliErr); ok {
 			payload := map[string]any{"ok": false, "error": map[string]any{"code": ce.Code, "message": ce.Msg, "details": ce.Details}}
@@ -95,3 +95,35 @@ func TestTweetCRUD(t *testing.T) {
 		}
 	})
 }
+
+func TestWriteJSONKeepsBackupAndRecovers(t *testing.T) {
+	withTempCwd(t, func() {
+		if _, err := createTweet("one", nil, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := createTweet("two", nil, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		bak, err := readJSON(tweetsPath()+".bak", []Tweet{})
+		if err != nil || len(bak) != 1 {
+			t.Fatalf("bak=%+v err=%v", bak, err)
+		}
+		if err := os.WriteFile(tweetsPath(), []byte(`[{"id":"trunc`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		all, err := listTweets("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 1 || all[0].Content != "one" {
+			t.Fatalf("recovered=%+v", all)
+		}
+		if _, err := os.Stat(tweetsPath() + ".corrupt"); err != nil {
+			t.Fatal(err)
+		}
+		again, err := readJSON(tweetsPath(), []Tweet{})
+		if err != nil || len(again) != 1 {
+			t.Fatalf("not restored on disk: %+v %v", again, err)
+		}
+	})
+}
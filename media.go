@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	imageKind = "image"
+	gifKind   = "gif"
+	videoKind = "video"
+
+	maxImages     = 4
+	maxImageBytes = 5 << 20
+	maxGIFBytes   = 15 << 20
+	maxVideoBytes = 512 << 20
+	maxAltLen     = 1000
+)
+
+// Media is a local file attached to a draft. It is uploaded at post time, so
+// only the path and what was validated at draft time are stored.
+type Media struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+	Size int64  `json:"size"`
+	Alt  string `json:"alt,omitempty"`
+}
+
+var mediaTypes = map[string]struct{ mime, kind string }{
+	".jpg":  {"image/jpeg", imageKind},
+	".jpeg": {"image/jpeg", imageKind},
+	".png":  {"image/png", imageKind},
+	".webp": {"image/webp", imageKind},
+	".gif":  {"image/gif", gifKind},
+	".mp4":  {"video/mp4", videoKind},
+	".mov":  {"video/quicktime", videoKind},
+}
+
+// inspectMedia stats path and classifies it by extension.
+func inspectMedia(path string) (Media, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Media{}, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return Media{}, cliFail("INVALID_MEDIA", "Cannot read media file: "+path, map[string]any{"path": path})
+	}
+	if fi.IsDir() {
+		return Media{}, cliFail("INVALID_MEDIA", "Media path is a directory: "+path, map[string]any{"path": path})
+	}
+	mt, ok := mediaTypes[strings.ToLower(filepath.Ext(abs))]
+	if !ok {
+		return Media{}, cliFail("INVALID_MEDIA", "Unsupported media type: "+filepath.Ext(abs), map[string]any{"path": path, "supported": []string{"jpg", "png", "webp", "gif", "mp4", "mov"}})
+	}
+	return Media{Path: abs, Type: mt.mime, Kind: mt.kind, Size: fi.Size()}, nil
+}
+
+// validateMedia enforces X's attachment rules: up to four images, or exactly
+// one GIF or video, each under its size limit.
+func validateMedia(items []Media) error {
+	images, other := 0, 0
+	for _, m := range items {
+		limit := int64(maxImageBytes)
+		switch m.Kind {
+		case imageKind:
+			images++
+		case gifKind:
+			other++
+			limit = maxGIFBytes
+		case videoKind:
+			other++
+			limit = maxVideoBytes
+		default:
+			return cliFail("INVALID_MEDIA", "Unknown media kind: "+m.Kind, map[string]any{"path": m.Path})
+		}
+		if len([]rune(m.Alt)) > maxAltLen {
+			return cliFail("INVALID_MEDIA", fmt.Sprintf("Alt text for %s is over %d characters", filepath.Base(m.Path), maxAltLen), map[string]any{"path": m.Path})
+		}
+		if m.Size > limit {
+			return cliFail("INVALID_MEDIA", fmt.Sprintf("%s is %d bytes (max %d for %s)", filepath.Base(m.Path), m.Size, limit, m.Kind), map[string]any{"path": m.Path, "size": m.Size, "limit": limit})
+		}
+	}
+	if images > maxImages {
+		return cliFail("INVALID_MEDIA", fmt.Sprintf("Too many images: %d (max %d)", images, maxImages), nil)
+	}
+	if other > 1 || (other == 1 && images > 0) {
+		return cliFail("INVALID_MEDIA", "A GIF or video must be the only attachment", nil)
+	}
+	return nil
+}
+
+// refreshMedia re-stats attachments right before upload so files that moved
+// or grew since drafting are caught before anything is posted.
+func refreshMedia(items []Media) ([]Media, error) {
+	out := make([]Media, 0, len(items))
+	for _, m := range items {
+		cur, err := inspectMedia(m.Path)
+		if err != nil {
+			return nil, err
+		}
+		cur.Alt = m.Alt
+		out = append(out, cur)
+	}
+	return out, validateMedia(out)
+}
+
+type mediaSpec struct{ Path, Alt string }
+
+// splitMediaArgs pulls repeated --media <path> flags out of args, each
+// optionally followed by --alt <text> describing that file.
+func splitMediaArgs(args []string) ([]string, []mediaSpec, error) {
+	rest := []string{}
+	specs := []mediaSpec{}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, val, inline := strings.Cut(a, "=")
+		if name != "--media" && name != "--alt" {
+			rest = append(rest, a)
+			continue
+		}
+		if !inline {
+			if i+1 >= len(args) {
+				return nil, nil, cliFail("INVALID_ARGS", name+" needs a value", nil)
+			}
+			i++
+			val = args[i]
+		}
+		if name == "--media" {
+			specs = append(specs, mediaSpec{Path: val})
+			continue
+		}
+		if len(specs) == 0 || specs[len(specs)-1].Alt != "" {
+			return nil, nil, cliFail("INVALID_ARGS", "--alt must follow the --media it describes", nil)
+		}
+		specs[len(specs)-1].Alt = strings.TrimSpace(val)
+	}
+	return rest, specs, nil
+}
+
+func loadMedia(specs []mediaSpec) ([]Media, error) {
+	out := []Media{}
+	for _, sp := range specs {
+		m, err := inspectMedia(sp.Path)
+		if err != nil {
+			return nil, err
+		}
+		m.Alt = sp.Alt
+		out = append(out, m)
+	}
+	return out, validateMedia(out)
+}
+
+// missingAlt lists images and GIFs in tweets that have no description.
+func missingAlt(tweets []Tweet) []map[string]any {
+	out := []map[string]any{}
+	for _, t := range tweets {
+		for _, m := range t.Media {
+			if m.Alt == "" && m.Kind != videoKind {
+				out = append(out, map[string]any{"id": t.ID, "path": m.Path})
+			}
+		}
+	}
+	return out
+}
+
+// lintAlt reports images without alt text as warnings, or as a MISSING_ALT
+// error when require is set.
+func lintAlt(tweets []Tweet, require bool, ctx Ctx) ([]string, error) {
+	miss := missingAlt(tweets)
+	if len(miss) > 0 && require {
+		return nil, cliFail("MISSING_ALT", fmt.Sprintf("%d image(s) have no alt text", len(miss)), map[string]any{"media": miss})
+	}
+	warnings := []string{}
+	for _, m := range miss {
+		w := fmt.Sprintf("%s: %s has no alt text", m["id"], filepath.Base(m["path"].(string)))
+		warnings = append(warnings, w)
+		if !ctx.JSON {
+			fmt.Println("  Warning:", w)
+		}
+	}
+	return warnings, nil
+}
+
+const (
+	mediaUploadPath   = "/2/media/upload"
+	mediaMetadataPath = "/2/media/metadata"
+)
+
+var mediaChunkSize = 4 << 20
+
+// mediaProcessingTimeout bounds how long an upload waits for X to finish
+// processing it (videos and GIFs) before giving up with MEDIA_TIMEOUT.
+var mediaProcessingTimeout = 10 * time.Minute
+
+var mediaCategory = map[string]string{imageKind: "tweet_image", gifKind: "tweet_gif", videoKind: "tweet_video"}
+
+type mediaProcessing struct {
+	State          string `json:"state"`
+	CheckAfterSecs int    `json:"check_after_secs"`
+	Error          *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type mediaResponse struct {
+	Data struct {
+		ID             string           `json:"id"`
+		ProcessingInfo *mediaProcessing `json:"processing_info"`
+	} `json:"data"`
+	MediaIDString  string           `json:"media_id_string"`
+	ProcessingInfo *mediaProcessing `json:"processing_info"`
+}
+
+func (r mediaResponse) id() string { return first(r.Data.ID, r.MediaIDString) }
+
+func (r mediaResponse) processing() *mediaProcessing {
+	if r.Data.ProcessingInfo != nil {
+		return r.Data.ProcessingInfo
+	}
+	return r.ProcessingInfo
+}
+
+// uploadMedia runs the chunked INIT/APPEND/FINALIZE flow, polling STATUS while
+// X processes GIFs and videos, and returns the media id to attach.
+func (c twClient) uploadMedia(m Media) (string, error) {
+	if c.dry {
+		if !c.quiet {
+			fmt.Println("  [dry-run] Would upload:", m.Path)
+		}
+		return fmt.Sprintf("dry_media_%d", time.Now().UnixNano()), nil
+	}
+	f, err := os.Open(m.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	start, err := c.mediaForm(map[string]string{
+		"command":        "INIT",
+		"total_bytes":    strconv.FormatInt(m.Size, 10),
+		"media_type":     m.Type,
+		"media_category": mediaCategory[m.Kind],
+	})
+	if err != nil {
+		return "", err
+	}
+	id := start.id()
+	if id == "" {
+		return "", fmt.Errorf("media INIT returned no media id")
+	}
+	buf := make([]byte, mediaChunkSize)
+	for seg := 0; ; seg++ {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			if err := c.mediaAppend(id, seg, buf[:n]); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	fin, err := c.mediaForm(map[string]string{"command": "FINALIZE", "media_id": id})
+	if err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(mediaProcessingTimeout)
+	for p := fin.processing(); p != nil && p.State != "succeeded"; {
+		if p.State == "failed" {
+			msg := "media processing failed"
+			if p.Error != nil && p.Error.Message != "" {
+				msg += ": " + p.Error.Message
+			}
+			return "", fmt.Errorf("%s", msg)
+		}
+		wait := time.Duration(max(p.CheckAfterSecs, 1)) * time.Second
+		if time.Now().Add(wait).After(deadline) {
+			return "", cliFail("MEDIA_TIMEOUT", fmt.Sprintf("X was still processing %s after %s", filepath.Base(m.Path), mediaProcessingTimeout), map[string]any{"mediaId": id, "path": m.Path, "state": p.State})
+		}
+		time.Sleep(wait)
+		st, err := c.mediaStatus(id)
+		if err != nil {
+			return "", err
+		}
+		p = st.processing()
+	}
+	return id, nil
+}
+
+func (c twClient) mediaForm(fields map[string]string) (mediaResponse, error) {
+	u := c.url(mediaUploadPath)
+	form := url.Values{}
+	for k, v := range fields {
+		form.Set(k, v)
+	}
+	return c.doMedia(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, c.authorize(req, fields)
+	})
+}
+
+// mediaAppend sends one chunk as multipart/form-data; multipart fields are
+// not part of the OAuth 1.0a signature base string.
+func (c twClient) mediaAppend(id string, seg int, chunk []byte) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	_ = w.WriteField("command", "APPEND")
+	_ = w.WriteField("media_id", id)
+	_ = w.WriteField("segment_index", strconv.Itoa(seg))
+	part, err := w.CreateFormFile("media", "chunk")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(chunk); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	u := c.url(mediaUploadPath)
+	_, err = c.doMedia(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req, c.authorize(req, nil)
+	})
+	return err
+}
+
+func (c twClient) mediaStatus(id string) (mediaResponse, error) {
+	q := map[string]string{"command": "STATUS", "media_id": id}
+	u := c.url(mediaUploadPath)
+	return c.doMedia(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, u+"?command=STATUS&media_id="+url.QueryEscape(id), nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, c.authorize(req, q)
+	})
+}
+
+// setAltText attaches a description to uploaded media via the metadata
+// endpoint; the JSON body is not part of the OAuth signature.
+func (c twClient) setAltText(id, alt string) error {
+	if c.dry {
+		if !c.quiet {
+			fmt.Println("  [dry-run] Would set alt text:", strconv.Quote(alt))
+		}
+		return nil
+	}
+	u := c.url(mediaMetadataPath)
+	raw, _ := json.Marshal(map[string]any{"id": id, "metadata": map[string]any{"alt_text": map[string]string{"text": alt}}})
+	_, err := c.doMedia(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, c.authorize(req, nil)
+	})
+	return err
+}
+
+func (c twClient) doMedia(build func() (*http.Request, error)) (mediaResponse, error) {
+	b, err := c.send(build)
+	if err != nil {
+		return mediaResponse{}, err
+	}
+	var out mediaResponse
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := json.Unmarshal(b, &out); err != nil {
+			return mediaResponse{}, err
+		}
+	}
+	return out, nil
+}
+
+// postWithMedia uploads the attachments, then posts text with them.
+func (c twClient) postWithMedia(text string, replyTo *string, media []Media) (postResult, error) {
+	ids, err := c.uploadAll(media)
+	if err != nil {
+		return postResult{}, err
+	}
+	return c.post(text, replyTo, ids)
+}
+
+// uploadAll uploads a tweet's attachments in order and returns their ids.
+func (c twClient) uploadAll(items []Media) ([]string, error) {
+	ids := make([]string, 0, len(items))
+	for _, m := range items {
+		id, err := c.uploadMedia(m)
+		if err != nil {
+			return nil, fmt.Errorf("upload %s: %w", filepath.Base(m.Path), err)
+		}
+		if m.Alt != "" {
+			if err := c.setAltText(id, m.Alt); err != nil {
+				return nil, fmt.Errorf("alt text for %s: %w", filepath.Base(m.Path), err)
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValidateMedia(t *testing.T) {
+	img := Media{Path: "a.png", Kind: imageKind, Size: 1000}
+	vid := Media{Path: "v.mp4", Kind: videoKind, Size: 1000}
+	cases := []struct {
+		items []Media
+		ok    bool
+	}{
+		{[]Media{img, img, img, img}, true},
+		{[]Media{img, img, img, img, img}, false},
+		{[]Media{vid}, true},
+		{[]Media{vid, img}, false},
+		{[]Media{{Path: "g.gif", Kind: gifKind, Size: 1}, {Path: "h.gif", Kind: gifKind, Size: 1}}, false},
+		{[]Media{{Path: "big.png", Kind: imageKind, Size: maxImageBytes + 1}}, false},
+	}
+	for i, c := range cases {
+		if err := validateMedia(c.items); (err == nil) != c.ok {
+			t.Fatalf("case %d: err=%v", i, err)
+		}
+	}
+}
+
+func TestDraftWithMediaAndChunkedUpload(t *testing.T) {
+	withTempCwd(t, func() {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "shot.png")
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", 10)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		res, err := draftCmd([]string{"look", "at", "this", "--media", path}, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := res.(map[string]any)["tweet"].(Tweet)
+		if tw.Content != "look at this" || len(tw.Media) != 1 || tw.Media[0].Type != "image/png" || tw.Media[0].Size != 10 {
+			t.Fatalf("tweet=%+v", tw)
+		}
+
+		var mu sync.Mutex
+		var commands []string
+		appended := 0
+		alt := ""
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "OAuth ") {
+				t.Errorf("missing oauth header")
+			}
+			if r.URL.Path == mediaMetadataPath {
+				var body struct {
+					ID       string `json:"id"`
+					Metadata struct {
+						AltText struct {
+							Text string `json:"text"`
+						} `json:"alt_text"`
+					} `json:"metadata"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				if body.ID == "m1" {
+					alt = body.Metadata.AltText.Text
+				}
+				return
+			}
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+				f, _, err := r.FormFile("media")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				b, _ := io.ReadAll(f)
+				appended += len(b)
+			} else {
+				_ = r.ParseForm()
+			}
+			cmd := r.FormValue("command")
+			commands = append(commands, cmd)
+			if cmd == "INIT" {
+				_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"id": "m1"}})
+				return
+			}
+			if r.FormValue("media_id") != "m1" {
+				t.Errorf("%s without media_id", cmd)
+			}
+			if cmd == "FINALIZE" {
+				_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"id": "m1"}})
+			}
+		}))
+		defer srv.Close()
+		prevChunk := mediaChunkSize
+		mediaChunkSize = 4
+		defer func() { mediaChunkSize = prevChunk }()
+
+		tw.Media[0].Alt = "a screenshot"
+		ids, err := twClient{base: srv.URL}.uploadAll(tw.Media)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 1 || ids[0] != "m1" || appended != 10 || alt != "a screenshot" {
+			t.Fatalf("ids=%v appended=%d alt=%q", ids, appended, alt)
+		}
+		if got := strings.Join(commands, ","); got != "INIT,APPEND,APPEND,APPEND,FINALIZE" {
+			t.Fatalf("commands=%s", got)
+		}
+	})
+}
+
+func TestAltTextArgsAndLint(t *testing.T) {
+	rest, specs, err := splitMediaArgs([]string{"hi", "--media", "a.png", "--alt", "a chart", "--media=b.png", "there"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rest, " ") != "hi there" || len(specs) != 2 || specs[0].Alt != "a chart" || specs[1].Alt != "" {
+		t.Fatalf("rest=%v specs=%+v", rest, specs)
+	}
+	if _, _, err := splitMediaArgs([]string{"--alt", "orphan"}); err == nil {
+		t.Fatal("expected error for --alt without --media")
+	}
+	tw := []Tweet{{ID: "t1", Media: []Media{{Path: "/x/a.png", Kind: imageKind, Alt: "ok"}, {Path: "/x/b.png", Kind: imageKind}, {Path: "/x/v.mp4", Kind: videoKind}}}}
+	warnings, err := lintAlt(tw, false, Ctx{JSON: true})
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "b.png") {
+		t.Fatalf("warnings=%v err=%v", warnings, err)
+	}
+	if _, err := lintAlt(tw, true, Ctx{JSON: true}); err == nil || err.(*CliErr).Code != "MISSING_ALT" {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestMediaProcessingTimesOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(path, []byte("video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		data := map[string]any{"id": "m1"}
+		if cmd := r.FormValue("command"); cmd == "FINALIZE" || r.Method == http.MethodGet {
+			data["processing_info"] = map[string]any{"state": "in_progress", "check_after_secs": 1}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer srv.Close()
+	prev := mediaProcessingTimeout
+	mediaProcessingTimeout = 0
+	defer func() { mediaProcessingTimeout = prev }()
+
+	_, err := twClient{base: srv.URL}.uploadAll([]Media{{Path: path, Type: "video/mp4", Kind: videoKind, Size: 5}})
+	ce, ok := apiFail("POST_FAILED", "upload failed", err, map[string]any{}).(*CliErr)
+	if !ok || ce.Code != "MEDIA_TIMEOUT" {
+		t.Fatalf("err=%v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultProfile lives directly in the root data directory, so stores from
+// before profiles existed keep working as the default account.
+const defaultProfile = "default"
+
+var profileNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// profileState is profiles.json in the root data directory.
+type profileState struct {
+	Current string `json:"current,omitempty"`
+}
+
+func profilesPath() string { return filepath.Join(rootDir(), "profiles.json") }
+
+func profileDir(name string) string {
+	if name == defaultProfile {
+		return rootDir()
+	}
+	return filepath.Join(rootDir(), "profiles", name)
+}
+
+// currentProfile is --profile (exported as XPOSTCTL_PROFILE), then the one
+// picked with profile use, then default.
+func currentProfile() string {
+	if p := strings.TrimSpace(os.Getenv("XPOSTCTL_PROFILE")); p != "" {
+		return p
+	}
+	st, _ := readJSON(profilesPath(), profileState{})
+	return first(st.Current, defaultProfile)
+}
+
+func profileExists(name string) bool {
+	if name == defaultProfile {
+		return true
+	}
+	st, err := os.Stat(profileDir(name))
+	return err == nil && st.IsDir()
+}
+
+// requireProfile stops commands from silently creating a store for a
+// mistyped profile name.
+func requireProfile() error {
+	name := currentProfile()
+	if !profileNameRe.MatchString(name) {
+		return cliFail("INVALID_ARGS", "Invalid profile name: "+name, nil)
+	}
+	if !profileExists(name) {
+		return cliFail("NOT_FOUND", "Profile not found: "+name, map[string]any{"profile": name, "hint": "tweet profile add " + name})
+	}
+	return nil
+}
+
+func listProfiles() ([]string, error) {
+	names := []string{defaultProfile}
+	entries, err := os.ReadDir(filepath.Join(rootDir(), "profiles"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && profileNameRe.MatchString(e.Name()) && e.Name() != defaultProfile {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// accountInfo caches the X account a profile's credentials belong to, so
+// posts can be stamped with it without asking X every time.
+type accountInfo struct {
+	xUser
+	// Creds fingerprints the credentials the lookup was made with; a
+	// mismatch means the keys changed and the cache is stale.
+	Creds string `json:"creds"`
+	// FailedAt is set instead of the user when the last lookup failed.
+	FailedAt string `json:"failedAt,omitempty"`
+}
+
+const (
+	// accountLookupTimeout bounds the one request account makes.
+	accountLookupTimeout = 5 * time.Second
+	// accountRetryAfter is how long a failed lookup is not repeated.
+	accountRetryAfter = time.Hour
+)
+
+func accountPath() string { return filepath.Join(dataDir(), "account.json") }
+
+func accountIn(dir string) *accountInfo {
+	a, _ := readJSON[*accountInfo](filepath.Join(dir, "account.json"), nil)
+	return a
+}
+
+func (c twClient) credsFingerprint() string {
+	if c.oauth2 != nil {
+		return "oauth2:" + c.oauth2.ClientID
+	}
+	sum := sha256.Sum256([]byte(c.creds.APIKey + "&" + c.creds.AccessToken))
+	return "oauth1:" + hex.EncodeToString(sum[:8])
+}
+
+func (c twClient) saveAccount(u xUser) error {
+	return writeJSON(accountPath(), accountInfo{xUser: u, Creds: c.credsFingerprint()})
+}
+
+// account is the username posts from this client go out as, looked up once
+// per set of credentials. It is "" when unknown; a failed lookup never
+// blocks a post. The lookup is a single short request, and a failure is
+// remembered for accountRetryAfter so a down X or a bad key does not slow
+// every post.
+func (c twClient) account() string {
+	if a := accountIn(dataDir()); a != nil && a.Creds == c.credsFingerprint() {
+		if a.Username != "" {
+			return a.Username
+		}
+		if at, err := time.Parse(time.RFC3339, a.FailedAt); err == nil && time.Since(at) < accountRetryAfter {
+			return ""
+		}
+	}
+	if c.dry {
+		return ""
+	}
+	c.maxAttempts, c.quiet, c.timeout = 1, true, accountLookupTimeout
+	u, err := c.me()
+	if err != nil {
+		_ = writeJSON(accountPath(), accountInfo{Creds: c.credsFingerprint(), FailedAt: time.Now().UTC().Format(time.RFC3339)})
+		return ""
+	}
+	_ = c.saveAccount(u)
+	return u.Username
+}
+
+func describeAccount(profile, account string) string {
+	if account == "" {
+		return "profile " + profile
+	}
+	return "@" + account + " (profile " + profile + ")"
+}
+
+func profileCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) == 0 || args[0] == "list" {
+		return profileListCmd(ctx)
+	}
+	if len(args) < 2 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet profile [list|add <name>|remove <name> [--force]|use <name>]", nil)
+	}
+	name := args[1]
+	if !profileNameRe.MatchString(name) {
+		return nil, cliFail("INVALID_ARGS", "Profile names use a-z, 0-9, - and _ (max 32): "+name, nil)
+	}
+	switch args[0] {
+	case "add":
+		return profileAddCmd(name, ctx)
+	case "remove", "rm":
+		return profileRemoveCmd(name, hasFlag(args[2:], "--force"), ctx)
+	case "use":
+		return profileUseCmd(name, ctx)
+	default:
+		return nil, cliFail("INVALID_ARGS", "Unknown profile subcommand: "+args[0], map[string]any{"available": []string{"list", "add", "remove", "use"}})
+	}
+}
+
+type profileInfo struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+	DataDir string `json:"dataDir"`
+	Account string `json:"account,omitempty"`
+}
+
+func profileListCmd(ctx Ctx) (any, error) {
+	names, err := listProfiles()
+	if err != nil {
+		return nil, err
+	}
+	cur := currentProfile()
+	out := make([]profileInfo, 0, len(names))
+	for _, n := range names {
+		p := profileInfo{Name: n, Current: n == cur, DataDir: profileDir(n)}
+		if a := accountIn(p.DataDir); a != nil {
+			p.Account = a.Username
+		}
+		out = append(out, p)
+	}
+	if !ctx.JSON {
+		fmt.Println()
+		for _, p := range out {
+			mark := " "
+			if p.Current {
+				mark = "*"
+			}
+			acct := ""
+			if p.Account != "" {
+				acct = "@" + p.Account
+			}
+			fmt.Printf("  %s %-16s %-18s %s\n", mark, p.Name, acct, p.DataDir)
+		}
+		fmt.Println()
+	}
+	return map[string]any{"current": cur, "profiles": out}, nil
+}
+
+// profileAddCmd creates an empty profile with the default config; its
+// credentials are then stored with auth set or come from its own
+// XPOSTCTL_<NAME>_ env vars.
+func profileAddCmd(name string, ctx Ctx) (any, error) {
+	if profileExists(name) {
+		return nil, cliFail("CONFLICT", "Profile already exists: "+name, map[string]any{"profile": name})
+	}
+	dir := profileDir(name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(dir, "config.json"), defaultConfig()); err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Println("  Added profile", name)
+		fmt.Println("  Store its credentials with: xpostctl --profile", name, "auth set apiKey (then apiSecret, accessToken, accessSecret)")
+		fmt.Println("  or set", profileEnv(name, "X_API_KEY"), "and its siblings")
+	}
+	return map[string]any{"profile": name, "dataDir": dir, "config": filepath.Join(dir, "config.json"), "hint": "xpostctl --profile " + name + " auth set apiKey"}, nil
+}
+
+// profileRemoveCmd deletes a profile's directory. A profile that still holds
+// tweets needs --force, since its store goes with it.
+func profileRemoveCmd(name string, force bool, ctx Ctx) (any, error) {
+	if name == defaultProfile {
+		return nil, cliFail("INVALID_ARGS", "The default profile cannot be removed", nil)
+	}
+	if !profileExists(name) {
+		return nil, cliFail("NOT_FOUND", "Profile not found: "+name, map[string]any{"profile": name})
+	}
+	if name == currentProfile() {
+		return nil, cliFail("CONFLICT", "Profile "+name+" is in use; switch with `tweet profile use default` first", map[string]any{"profile": name})
+	}
+	dir := profileDir(name)
+	if !force {
+		tweets, _ := readJSON(filepath.Join(dir, "tweets.json"), []Tweet{})
+		_, dbErr := os.Stat(filepath.Join(dir, "xpostctl.db"))
+		if len(tweets) > 0 || dbErr == nil {
+			return nil, cliFail("CONFLICT", "Profile "+name+" still has a tweet store; pass --force to delete it", map[string]any{"profile": name, "dataDir": dir})
+		}
+	}
+	if c, _ := readJSON(filepath.Join(dir, "config.json"), Config{}); c.Secrets == keyringBackend {
+		_ = keyringSecrets{user: keyringUser(name)}.Save(nil)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Println("  Removed profile", name)
+	}
+	return map[string]any{"profile": name, "removed": true}, nil
+}
+
+func profileUseCmd(name string, ctx Ctx) (any, error) {
+	if !profileExists(name) {
+		return nil, cliFail("NOT_FOUND", "Profile not found: "+name, map[string]any{"profile": name, "hint": "tweet profile add " + name})
+	}
+	if err := os.MkdirAll(rootDir(), 0o700); err != nil {
+		return nil, err
+	}
+	st := profileState{}
+	if name != defaultProfile {
+		st.Current = name
+	}
+	if err := writeJSON(profilesPath(), st); err != nil {
+		return nil, err
+	}
+	env := strings.TrimSpace(os.Getenv("XPOSTCTL_PROFILE"))
+	if !ctx.JSON {
+		fmt.Println("  Using profile", name)
+		if env != "" && env != name {
+			fmt.Println("  Note: XPOSTCTL_PROFILE (or --profile) still selects", env, "for this shell")
+		}
+	}
+	return map[string]any{"profile": name, "dataDir": profileDir(name)}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfilesSeparateStores(t *testing.T) {
+	withTempCwd(t, func() {
+		t.Setenv("XPOSTCTL_PROFILE", "")
+		ctx := Ctx{JSON: true}
+		base, err := createTweet("default account", nil, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := profileCmd([]string{"add", "acme"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := profileCmd([]string{"add", "acme"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("duplicate add err=%v", err)
+		}
+		if _, err := profileCmd([]string{"use", "acme"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got := dataDir(); got != filepath.Join(rootDir(), "profiles", "acme") {
+			t.Fatalf("dataDir=%s", got)
+		}
+		if got, _ := getTweet(base.ID); got != nil {
+			t.Fatal("default profile's tweet visible in acme")
+		}
+		if _, err := createTweet("company account", nil, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := profileCmd([]string{"remove", "acme"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("remove in use err=%v", err)
+		}
+
+		t.Setenv("XPOSTCTL_PROFILE", defaultProfile)
+		if got, _ := getTweet(base.ID); got == nil {
+			t.Fatal("default profile lost its tweet")
+		}
+		if _, err := profileCmd([]string{"remove", "acme"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("remove with tweets err=%v", err)
+		}
+		if _, err := profileCmd([]string{"remove", "acme", "--force"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("XPOSTCTL_PROFILE", "acme")
+		if err := requireProfile(); err == nil || err.(*CliErr).Code != "NOT_FOUND" {
+			t.Fatalf("err=%v", err)
+		}
+	})
+}
+
+func TestParseArgsProfile(t *testing.T) {
+	cmd, args, ctx := parseArgs([]string{"list", "--profile", "acme", "drafts", "--json"})
+	if cmd != "list" || len(args) != 1 || args[0] != "drafts" || ctx.Profile != "acme" || !ctx.JSON {
+		t.Fatalf("cmd=%q args=%v ctx=%+v", cmd, args, ctx)
+	}
+	if _, _, ctx := parseArgs([]string{"post", "--profile=me"}); ctx.Profile != "me" {
+		t.Fatalf("ctx=%+v", ctx)
+	}
+}
+
+func TestPostRecordsProfileAndAccount(t *testing.T) {
+	withTempCwd(t, func() {
+		withFakeX(t)
+		if _, err := profileCmd([]string{"add", "acme"}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("XPOSTCTL_PROFILE", "acme")
+		tw, err := createTweet("hello from acme", nil, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := postCmd([]string{tw.ID}, Ctx{JSON: true}); err == nil {
+			t.Fatal("acme posted with the default profile's X_API_KEY")
+		}
+		if a := accountIn(dataDir()); a == nil || a.FailedAt == "" || a.Username != "" {
+			t.Fatalf("failed lookup not cached: %+v", a)
+		}
+		_, err = doctorCmd(nil, Ctx{JSON: true})
+		ce, ok := err.(*CliErr)
+		if !ok || ce.Code != "DOCTOR_FAILED" {
+			t.Fatalf("doctor err=%v", err)
+		}
+		warned := false
+		for _, c := range ce.Details.(map[string]any)["checks"].([]doctorCheck) {
+			warned = warned || (c.Name == "env" && strings.Contains(c.Detail, "XPOSTCTL_ACME_X_API_KEY"))
+		}
+		if !warned {
+			t.Fatalf("checks=%+v, want the ignored X_API_KEY named", ce.Details)
+		}
+		for _, k := range []string{"X_API_KEY", "X_API_SECRET", "X_ACCESS_TOKEN", "X_ACCESS_SECRET"} {
+			t.Setenv(profileEnv("acme", k), os.Getenv(k))
+		}
+		if _, err := postCmd([]string{tw.ID}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := getTweet(tw.ID)
+		if got.Profile != "acme" || got.Account != "fakeuser" {
+			t.Fatalf("profile=%q account=%q", got.Profile, got.Account)
+		}
+		if _, err := os.Stat(accountPath()); err != nil {
+			t.Fatalf("account not cached: %v", err)
+		}
+	})
+}
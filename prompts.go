@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// promptData is what prompt templates see.
+type promptData struct {
+	Mode     string   // single, thread or ideas
+	Topic    string   // the topic asked for; empty for ideas
+	Topics   []string // ai.topics, or --topic for ideas
+	Tone     string
+	Avoid    []string
+	Recent   []string // the latest posted tweets, newest first
+	Today    string   // YYYY-MM-DD
+	MaxChars int
+}
+
+// recentPosts is how many posted tweets templates get as .Recent.
+const recentPosts = 5
+
+// promptSystem is the default system prompt. A template can replace it with
+// its own {{define "system"}}.
+const promptSystem = `{{define "system"}}You write posts for X (Twitter). Write in plain text: no hashtags unless asked, no emoji spam, no surrounding quotes, no preamble. Reply with the post text only.
+{{- if .Tone}}
+Tone: {{.Tone}}.{{end}}
+{{- if .Avoid}}
+Never include: {{join .Avoid "; "}}.{{end}}{{end}}`
+
+const promptRecent = `{{if .Recent}}
+
+Recent posts; do not repeat them:
+{{range .Recent}}- {{.}}
+{{end}}{{end}}`
+
+var builtinPrompts = map[string]string{
+	"single": `Write one tweet about: {{.Topic}}
+It must fit in {{.MaxChars}} characters.` + promptRecent,
+	"thread": `Write a thread of 4 to 6 tweets about: {{.Topic}}
+Each tweet must fit in {{.MaxChars}} characters. Put a line containing only --- between tweets.` + promptRecent,
+	"ideas": `Generate 10 tweet ideas for the week of {{.Today}}, one per line, numbered 1-10. Prefix ideas that need more room with [THREAD].
+{{- if .Topics}}
+Draw them from these topics: {{join .Topics ", "}}.{{end}}` + promptRecent,
+}
+
+var promptNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+var promptFuncs = template.FuncMap{"join": strings.Join}
+
+func promptsDir() string            { return filepath.Join(dataDir(), "prompts") }
+func promptPath(name string) string { return filepath.Join(promptsDir(), name+".tmpl") }
+
+// loadPrompt returns the template source for name: the file under prompts/
+// when there is one, the built-in otherwise.
+func loadPrompt(name string) (string, bool, error) {
+	if !promptNameRe.MatchString(name) {
+		return "", false, cliFail("INVALID_ARGS", "Prompt names use a-z, 0-9, - and _: "+name, nil)
+	}
+	raw, err := os.ReadFile(promptPath(name))
+	if err == nil {
+		return string(raw), true, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+	if src, ok := builtinPrompts[name]; ok {
+		return src, false, nil
+	}
+	return "", false, cliFail("NOT_FOUND", "Prompt not found: "+name, map[string]any{"path": promptPath(name), "hint": "tweet prompt edit " + name})
+}
+
+func parsePrompt(name, src string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(promptFuncs).Option("missingkey=error").Parse(promptSystem)
+	if err == nil {
+		_, err = t.Parse(src)
+	}
+	if err != nil {
+		return nil, cliFail("INVALID_PROMPT", "Prompt "+name+" does not parse: "+err.Error(), map[string]any{"path": promptPath(name)})
+	}
+	return t, nil
+}
+
+// renderPrompt runs template name and returns the system and user prompts.
+func renderPrompt(name string, d promptData) (string, string, error) {
+	src, _, err := loadPrompt(name)
+	if err != nil {
+		return "", "", err
+	}
+	t, err := parsePrompt(name, src)
+	if err != nil {
+		return "", "", err
+	}
+	var sys, user strings.Builder
+	if err := t.ExecuteTemplate(&sys, "system", d); err != nil {
+		return "", "", cliFail("INVALID_PROMPT", "Prompt "+name+" failed: "+err.Error(), nil)
+	}
+	if err := t.Execute(&user, d); err != nil {
+		return "", "", cliFail("INVALID_PROMPT", "Prompt "+name+" failed: "+err.Error(), nil)
+	}
+	return strings.TrimSpace(sys.String()), strings.TrimSpace(user.String()), nil
+}
+
+// genPrompt builds the request for mode from prompt template name (the
+// mode's own template when empty) and the ai section of the config.
+func genPrompt(name, mode, topic string, topics []string, cfg Config) (genRequest, error) {
+	d := promptData{Mode: mode, Topic: topic, Topics: topics, Tone: strings.TrimSpace(cfg.AI.Tone), Avoid: cfg.AI.Avoid, Today: time.Now().Format("2006-01-02"), MaxChars: maxTweetLength}
+	posted, err := listTweets(postedStatus)
+	if err != nil {
+		return genRequest{}, err
+	}
+	sort.SliceStable(posted, func(i, j int) bool { return first(deref(posted[i].PostedAt)) > first(deref(posted[j].PostedAt)) })
+	for i := 0; i < len(posted) && len(d.Recent) < recentPosts; i++ {
+		d.Recent = append(d.Recent, posted[i].Content)
+	}
+	sys, user, err := renderPrompt(first(name, mode), d)
+	if err != nil {
+		return genRequest{}, err
+	}
+	return genRequest{Mode: mode, Topic: topic, Topics: topics, System: sys, Prompt: user}, nil
+}
+
+// runEditor opens path in $VISUAL or $EDITOR; tests replace it.
+var runEditor = func(path string) error {
+	ed := strings.Fields(first(os.Getenv("VISUAL"), os.Getenv("EDITOR")))
+	if len(ed) == 0 {
+		ed = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			ed = []string{"notepad"}
+		}
+	}
+	cmd := exec.Command(ed[0], append(ed[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func promptCmd(args []string, ctx Ctx) (any, error) {
+	if err := ensureData(); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		return promptListCmd(ctx)
+	}
+	if len(args) != 2 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet prompt [list|show <name>|edit <name>|reset <name>]", nil)
+	}
+	name := args[1]
+	switch args[0] {
+	case "show":
+		src, custom, err := loadPrompt(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ctx.JSON {
+			fmt.Println(src)
+		}
+		return map[string]any{"name": name, "custom": custom, "path": promptPath(name), "template": src}, nil
+	case "edit":
+		return promptEditCmd(name, ctx)
+	case "reset":
+		if _, _, err := loadPrompt(name); err != nil {
+			return nil, err
+		}
+		if err := os.Remove(promptPath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		_, builtin := builtinPrompts[name]
+		if !ctx.JSON {
+			if builtin {
+				fmt.Println("  Prompt", name, "is back to the built-in")
+			} else {
+				fmt.Println("  Removed prompt", name)
+			}
+		}
+		return map[string]any{"name": name, "builtin": builtin}, nil
+	default:
+		return nil, cliFail("INVALID_ARGS", "Unknown prompt subcommand: "+args[0], map[string]any{"available": []string{"list", "show", "edit", "reset"}})
+	}
+}
+
+type promptInfo struct {
+	Name    string `json:"name"`
+	Custom  bool   `json:"custom"`
+	Builtin bool   `json:"builtin"`
+	Path    string `json:"path,omitempty"`
+}
+
+func promptListCmd(ctx Ctx) (any, error) {
+	byName := map[string]*promptInfo{}
+	for n := range builtinPrompts {
+		byName[n] = &promptInfo{Name: n, Builtin: true}
+	}
+	entries, err := os.ReadDir(promptsDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		n, ok := strings.CutSuffix(e.Name(), ".tmpl")
+		if !ok || e.IsDir() || !promptNameRe.MatchString(n) {
+			continue
+		}
+		if byName[n] == nil {
+			byName[n] = &promptInfo{Name: n}
+		}
+		byName[n].Custom, byName[n].Path = true, promptPath(n)
+	}
+	out := make([]promptInfo, 0, len(byName))
+	for _, p := range byName {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	if !ctx.JSON {
+		fmt.Println()
+		for _, p := range out {
+			kind := "built-in"
+			switch {
+			case p.Custom && p.Builtin:
+				kind = "edited"
+			case p.Custom:
+				kind = "custom"
+			}
+			fmt.Printf("  %-16s %-9s %s\n", p.Name, kind, p.Path)
+		}
+		fmt.Println()
+	}
+	return map[string]any{"dir": promptsDir(), "prompts": out}, nil
+}
+
+// promptEditCmd opens the prompt in an editor, starting from the built-in
+// (or the single-tweet one for a new name), and checks it still parses.
+func promptEditCmd(name string, ctx Ctx) (any, error) {
+	src, custom, err := loadPrompt(name)
+	var ce *CliErr
+	if errors.As(err, &ce) && ce.Code == "NOT_FOUND" {
+		src, err = builtinPrompts["single"], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !custom {
+		if err := os.MkdirAll(promptsDir(), 0o700); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(promptPath(name), []byte(src+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	if err := runEditor(promptPath(name)); err != nil {
+		return nil, cliFail("EDITOR_FAILED", "Editor failed: "+err.Error(), map[string]any{"path": promptPath(name), "hint": "set VISUAL or EDITOR"})
+	}
+	raw, err := os.ReadFile(promptPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parsePrompt(name, string(raw)); err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Println("  Saved prompt", name, "to", promptPath(name))
+	}
+	return map[string]any{"name": name, "path": promptPath(name)}, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderBuiltinPrompt(t *testing.T) {
+	withTempCwd(t, func() {
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		for i, text := range []string{"older post", "newer post", "still a draft"} {
+			tw, err := createTweet(text, nil, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == 2 {
+				continue
+			}
+			ts := []string{"2026-01-01T00:00:00Z", "2026-02-01T00:00:00Z"}[i]
+			if _, err := updateTweet(tw.ID, func(x *Tweet) { x.Status, x.PostedAt = postedStatus, &ts }); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var cfg Config
+		cfg.AI.Tone = "dry"
+		req, err := genPrompt("", "single", "caching", nil, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(req.System, "Tone: dry") || !strings.Contains(req.Prompt, "about: caching") {
+			t.Fatalf("req=%+v", req)
+		}
+		if strings.Index(req.Prompt, "newer post") > strings.Index(req.Prompt, "older post") || strings.Contains(req.Prompt, "still a draft") {
+			t.Fatalf("recent=%q", req.Prompt)
+		}
+	})
+}
+
+func TestCustomPromptTemplate(t *testing.T) {
+	withTempCwd(t, func() {
+		seen := withFakeLLM(t, func(prompt string) (int, string) {
+			return http.StatusOK, "Launch day."
+		})
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(promptsDir(), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		src := `{{define "system"}}You announce launches.{{end}}Announce {{.Topic}} ({{.Mode}}, max {{.MaxChars}}).`
+		if err := os.WriteFile(promptPath("launch"), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := generateCmd([]string{"v2", "--prompt", "launch"}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		msgs := (*seen)[0]["messages"].([]any)
+		if sys := msgs[0].(map[string]any)["content"]; sys != "You announce launches." {
+			t.Fatalf("system=%q", sys)
+		}
+		if user := msgs[1].(map[string]any)["content"]; user != "Announce v2 (single, max 280)." {
+			t.Fatalf("user=%q", user)
+		}
+		if _, err := generateCmd([]string{"v2", "--prompt", "nope"}, Ctx{JSON: true}); err == nil || err.(*CliErr).Code != "NOT_FOUND" {
+			t.Fatalf("missing prompt err=%v", err)
+		}
+	})
+}
+
+func TestPromptEditAndReset(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		body := "Write one tweet about {{.Topic}}, in haiku form."
+		orig := runEditor
+		t.Cleanup(func() { runEditor = orig })
+		runEditor = func(path string) error { return os.WriteFile(path, []byte(body), 0o600) }
+
+		if _, err := promptCmd([]string{"edit", "single"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		res, err := promptCmd([]string{"show", "single"}, ctx)
+		if err != nil || res.(map[string]any)["template"] != body {
+			t.Fatalf("show res=%v err=%v", res, err)
+		}
+		if _, err := promptCmd([]string{"edit", "teaser"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		res, err = promptCmd([]string{"list"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds := map[string]promptInfo{}
+		for _, p := range res.(map[string]any)["prompts"].([]promptInfo) {
+			kinds[p.Name] = p
+		}
+		if !kinds["single"].Custom || !kinds["single"].Builtin || kinds["thread"].Custom || kinds["teaser"].Builtin {
+			t.Fatalf("list=%+v", kinds)
+		}
+
+		body = "{{.Topic"
+		if _, err := promptCmd([]string{"edit", "single"}, ctx); err == nil || err.(*CliErr).Code != "INVALID_PROMPT" {
+			t.Fatalf("bad template err=%v", err)
+		}
+		if _, err := promptCmd([]string{"reset", "single"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if src, custom, _ := loadPrompt("single"); custom || src != builtinPrompts["single"] {
+			t.Fatalf("after reset custom=%v", custom)
+		}
+		if _, err := promptCmd([]string{"reset", "teaser"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := loadPrompt("teaser"); err == nil {
+			t.Fatal("teaser still present")
+		}
+	})
+}
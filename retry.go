@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMaxAttempts = 4
+
+// Retry tuning; tests shorten the delays and replace sleep.
+var (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+	// maxRateLimitWait is the longest send waits for a rate-limit window to
+	// reset; beyond it the call fails with RATE_LIMITED instead.
+	maxRateLimitWait = 2 * time.Minute
+	sleep            = time.Sleep
+)
+
+// maxAttempts is how many times one X API call is tried: config
+// retry.maxAttempts, overridden by XPOSTCTL_MAX_ATTEMPTS.
+func maxAttempts(cfg Config) int {
+	n := cfg.Retry.MaxAttempts
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("XPOSTCTL_MAX_ATTEMPTS"))); err == nil {
+		n = v
+	}
+	if n < 1 {
+		return defaultMaxAttempts
+	}
+	return n
+}
+
+// send performs the request built by build, retrying network errors, 5xx and
+// 429 with jittered exponential backoff. build runs once per attempt so every
+// try gets a fresh OAuth nonce and body. On success it returns the body.
+func (c twClient) send(build func() (*http.Request, error)) ([]byte, error) {
+	return c.sendRetrying(build, false)
+}
+
+// sendCreate is send for POST /2/tweets. It only retries when X cannot have
+// created the tweet: a 429, a 503, or a connection that was never made. After
+// any other failure the tweet may exist, and a retry would only get X's
+// duplicate-content error and lose the real tweet id, so it returns a
+// maybePostedError instead.
+func (c twClient) sendCreate(build func() (*http.Request, error)) ([]byte, error) {
+	return c.sendRetrying(build, true)
+}
+
+// maybePostedError is a failed create after which the tweet may still have
+// been posted.
+type maybePostedError struct{ err error }
+
+func (e *maybePostedError) Error() string {
+	return e.err.Error() + " (the tweet may have been posted; check the timeline before retrying)"
+}
+
+func (e *maybePostedError) Unwrap() error { return e.err }
+
+// notSent reports whether a transport error happened before the request
+// could reach X: the connection was never made.
+func notSent(err error) bool {
+	var dns *net.DNSError
+	var op *net.OpError
+	return errors.As(err, &dns) || (errors.As(err, &op) && op.Op == "dial")
+}
+
+func (c twClient) sendRetrying(build func() (*http.Request, error), create bool) ([]byte, error) {
+	attempts := max(c.maxAttempts, 1)
+	for n := 1; ; n++ {
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+		wait := backoff(n)
+		cancel := context.CancelFunc(func() {})
+		if c.timeout > 0 {
+			var rctx context.Context
+			rctx, cancel = context.WithTimeout(req.Context(), c.timeout)
+			req = req.WithContext(rctx)
+		}
+		res, err := xHTTPClient.Do(req)
+		if err == nil {
+			b, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			cancel()
+			if res.StatusCode >= 200 && res.StatusCode < 300 {
+				return b, nil
+			}
+			ae := newAPIError(res.StatusCode, b)
+			ae.ResetAt = rateLimitReset(res.Header, time.Now())
+			if !retryable(res.StatusCode) {
+				return nil, ae
+			}
+			if create && res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+				return nil, &maybePostedError{ae}
+			}
+			if ae.ResetAt != nil {
+				wait = max(time.Until(*ae.ResetAt), wait)
+			}
+			if res.StatusCode == http.StatusTooManyRequests && wait > maxRateLimitWait {
+				return nil, ae
+			}
+			err = ae
+		} else {
+			cancel()
+			if create && !notSent(err) {
+				return nil, &maybePostedError{err}
+			}
+		}
+		if n >= attempts {
+			return nil, err
+		}
+		if !c.quiet {
+			fmt.Fprintf(os.Stderr, "  Retrying in %s (attempt %d/%d): %v\n", wait.Round(time.Second), n+1, attempts, err)
+		}
+		sleep(wait)
+	}
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff is full-jitter exponential backoff for attempt n (1-based).
+func backoff(n int) time.Duration {
+	d := retryBaseDelay << (n - 1)
+	if d <= 0 || d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// rateLimitReset reads when X will accept requests again from retry-after
+// (seconds or an HTTP date) or x-rate-limit-reset (unix seconds).
+func rateLimitReset(h http.Header, now time.Time) *time.Time {
+	var at time.Time
+	if v := strings.TrimSpace(h.Get("Retry-After")); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			at = now.Add(time.Duration(secs) * time.Second)
+		} else if t, err := http.ParseTime(v); err == nil {
+			at = t
+		}
+	}
+	if v := strings.TrimSpace(h.Get("X-Rate-Limit-Reset")); at.IsZero() && v != "" {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+			at = time.Unix(secs, 0)
+		}
+	}
+	if at.IsZero() {
+		return nil
+	}
+	at = at.UTC()
+	return &at
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendRetriesTransientFailures(t *testing.T) {
+	var waits []time.Duration
+	prevSleep, prevBase := sleep, retryBaseDelay
+	sleep, retryBaseDelay = func(d time.Duration) { waits = append(waits, d) }, time.Millisecond
+	defer func() { sleep, retryBaseDelay = prevSleep, prevBase }()
+
+	calls := 0
+	responses := []int{503, 429, 201}
+	reset := time.Now().Add(3 * time.Second).Unix()
+	stubXResponses(t, func() (int, http.Header, string) {
+		code := responses[calls]
+		calls++
+		h := http.Header{}
+		if code == 429 {
+			h.Set("x-rate-limit-reset", strconv.FormatInt(reset, 10))
+		}
+		return code, h, `{"data":{"id":"1","text":"hi"}}`
+	})
+	c := twClient{quiet: true, maxAttempts: 3}
+	r, err := c.post("hi", nil, nil)
+	if err != nil || r.ID != "1" || calls != 3 {
+		t.Fatalf("r=%+v err=%v calls=%d", r, err, calls)
+	}
+	if len(waits) != 2 || waits[1] < time.Second {
+		t.Fatalf("waits=%v (rate-limit reset not honored)", waits)
+	}
+
+	calls, responses = 0, []int{400}
+	if _, err := c.post("hi", nil, nil); err == nil || calls != 1 {
+		t.Fatalf("4xx retried: calls=%d err=%v", calls, err)
+	}
+
+	calls, responses = 0, []int{429, 429, 429}
+	reset = time.Now().Add(time.Hour).Unix()
+	_, err = c.post("hi", nil, nil)
+	if calls != 1 {
+		t.Fatalf("waited past maxRateLimitWait: calls=%d", calls)
+	}
+	ce := apiFail("POST_FAILED", "failed", err, map[string]any{}).(*CliErr)
+	if ce.Code != "RATE_LIMITED" || !strings.HasPrefix(ce.Details.(map[string]any)["resetAt"].(string), time.Unix(reset, 0).UTC().Format("2006-01-02T15")) {
+		t.Fatalf("err=%+v", ce)
+	}
+}
+
+func TestPostNotRetriedWhenItMayHaveGoneThrough(t *testing.T) {
+	prevSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = prevSleep }()
+
+	calls := 0
+	responses := []int{500, 201}
+	stubXResponses(t, func() (int, http.Header, string) {
+		code := responses[calls]
+		calls++
+		return code, http.Header{}, `{"data":{"id":"1","text":"hi"}}`
+	})
+	c := twClient{quiet: true, maxAttempts: 3}
+	_, err := c.post("hi", nil, nil)
+	var mp *maybePostedError
+	if !errors.As(err, &mp) || calls != 1 || !strings.Contains(err.Error(), "may have been posted") {
+		t.Fatalf("500 on create: calls=%d err=%v", calls, err)
+	}
+	if ce := apiFail("POST_FAILED", "failed", err, map[string]any{}).(*CliErr); ce.Details.(map[string]any)["status"] != 500 {
+		t.Fatalf("api details lost: %+v", ce)
+	}
+
+	// Other calls still retry a 500.
+	calls, responses = 0, []int{500, 200}
+	if _, err := c.send(func() (*http.Request, error) { return http.NewRequest(http.MethodGet, c.url("/2/tweets/1"), nil) }); err != nil || calls != 2 {
+		t.Fatalf("GET not retried: calls=%d err=%v", calls, err)
+	}
+
+	if !notSent(&net.OpError{Op: "dial", Err: errors.New("connection refused")}) || notSent(&net.OpError{Op: "read", Err: errors.New("reset")}) {
+		t.Fatal("notSent misclassified")
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := http.Header{}
+	h.Set("Retry-After", "120")
+	h.Set("X-Rate-Limit-Reset", "1")
+	if got := rateLimitReset(h, now); got == nil || !got.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("retry-after: %v", got)
+	}
+	h.Del("Retry-After")
+	if got := rateLimitReset(h, now); got == nil || got.Unix() != 1 {
+		t.Fatalf("reset: %v", got)
+	}
+	if rateLimitReset(http.Header{}, now) != nil {
+		t.Fatal("expected nil without headers")
+	}
+}
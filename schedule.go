@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	clockRe    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+	relativeRe = regexp.MustCompile(`^in\s+(\d+)\s*(m|min|mins|minutes?|h|hr|hrs|hours?|d|days?)$`)
+)
+
+// parseWhen understands RFC3339 timestamps, "2006-01-02 15:04" in local time,
+// "in 30m"/"in 2h"/"in 1d" and "[today|tomorrow|<weekday>] <clock>" such as
+// "tomorrow 9am". A bare clock is today if still ahead, otherwise tomorrow.
+func parseWhen(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty time")
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	s = strings.ToLower(s)
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02t15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if s == "now" {
+		return now, nil
+	}
+	if m := relativeRe.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := time.Minute
+		switch m[2][0] {
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		}
+		return now.Add(time.Duration(n) * unit), nil
+	}
+	day, clock, _ := strings.Cut(s, " ")
+	base := now
+	explicit := true
+	switch day {
+	case "today":
+	case "tomorrow":
+		base = now.AddDate(0, 0, 1)
+	default:
+		wd, ok := weekdays[day]
+		if !ok {
+			clock, explicit = s, false
+			break
+		}
+		diff := (int(wd) - int(now.Weekday()) + 7) % 7
+		if diff == 0 {
+			diff = 7
+		}
+		base = now.AddDate(0, 0, diff)
+	}
+	h, m := 9, 0
+	if clock = strings.TrimSpace(clock); clock != "" {
+		var err error
+		if h, m, err = parseClock(clock); err != nil {
+			return time.Time{}, fmt.Errorf("cannot parse time %q", s)
+		}
+	}
+	t := time.Date(base.Year(), base.Month(), base.Day(), h, m, 0, 0, now.Location())
+	if !explicit && !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+func parseClock(s string) (int, int, error) {
+	m := clockRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, fmt.Errorf("bad clock %q", s)
+	}
+	h, _ := strconv.Atoi(m[1])
+	min := 0
+	if m[2] != "" {
+		min, _ = strconv.Atoi(m[2])
+	}
+	if m[3] != "" && (h < 1 || h > 12) {
+		return 0, 0, fmt.Errorf("bad clock %q", s)
+	}
+	switch m[3] {
+	case "am":
+		if h == 12 {
+			h = 0
+		}
+	case "pm":
+		if h < 12 {
+			h += 12
+		}
+	}
+	if h > 23 || min > 59 {
+		return 0, 0, fmt.Errorf("bad clock %q", s)
+	}
+	return h, min, nil
+}
+
+// scheduleTargets resolves a tweet to the set of tweets that must move
+// together: the whole thread when it belongs to one, otherwise just itself.
+func scheduleTargets(t *Tweet) ([]Tweet, error) {
+	if t.ThreadID == nil {
+		return []Tweet{*t}, nil
+	}
+	return threadTweets(*t.ThreadID)
+}
+
+func scheduleCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) > 0 && args[0] == "list" {
+		return scheduleListCmd(ctx)
+	}
+	if len(args) > 0 && args[0] == "cancel" {
+		if len(args) < 2 {
+			return nil, cliFail("INVALID_ARGS", "Usage: tweet schedule cancel <id>", nil)
+		}
+		return scheduleCancelCmd(args[1], ctx)
+	}
+	id := ""
+	when := []string{}
+	inAt, force := false, false
+	for _, a := range args {
+		switch {
+		case a == "--at":
+			inAt = true
+		case a == "--force":
+			inAt, force = false, true
+		case strings.HasPrefix(a, "--at="):
+			when = append(when, strings.TrimPrefix(a, "--at="))
+		case strings.HasPrefix(a, "--"):
+			inAt = false
+		case inAt:
+			when = append(when, a)
+		case id == "":
+			id = a
+		}
+	}
+	if id == "" || len(when) == 0 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet schedule <id> --at <RFC3339|\"tomorrow 9am\"> [--force]", map[string]any{"examples": []string{"tweet schedule list", "tweet schedule cancel <id>"}})
+	}
+	now := time.Now()
+	at, err := parseWhen(strings.Join(when, " "), now)
+	if err != nil {
+		return nil, cliFail("INVALID_ARGS", "Invalid --at: "+err.Error(), nil)
+	}
+	if at.Before(now.Add(-time.Minute)) {
+		return nil, cliFail("INVALID_ARGS", "Scheduled time is in the past: "+at.Format(time.RFC3339), nil)
+	}
+	t, err := getTweet(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, cliFail("NOT_FOUND", "Tweet not found: "+id, nil)
+	}
+	// A partially posted thread can be rescheduled: its unposted members are
+	// scheduled and the worker resumes the thread after the last posted one.
+	ts := at.UTC().Format(time.RFC3339)
+	var out []Tweet
+	err = mutateTweets(func(v tweetView) ([]Tweet, error) {
+		targets, err := claimMembers(v, t)
+		if err != nil {
+			return nil, err
+		}
+		out = nil
+		for _, it := range targets {
+			if it.Status != postedStatus {
+				out = append(out, it)
+			}
+		}
+		if len(out) == 0 {
+			return nil, cliFail("CONFLICT", "Already posted: "+t.ID, map[string]any{"id": t.ID})
+		}
+		if err := inFlight(out); err != nil {
+			return nil, err
+		}
+		if !force {
+			if err := flaggedIn(out, "schedule"); err != nil {
+				return nil, err
+			}
+		}
+		for i := range out {
+			out[i].Status = scheduledStatus
+			out[i].ScheduledAt = &ts
+			out[i].FlagsAccepted = out[i].FlagsAccepted || (force && len(out[i].Flags) > 0)
+		}
+		return out, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		if len(out) > 1 {
+			fmt.Printf("  Scheduled thread (%d tweets) for %s\n", len(out), at.Local().Format("Mon 2006-01-02 15:04 MST"))
+		} else {
+			fmt.Printf("  Scheduled %s for %s\n", id, at.Local().Format("Mon 2006-01-02 15:04 MST"))
+		}
+	}
+	return map[string]any{"action": "scheduled", "scheduledAt": ts, "count": len(out), "tweets": out}, nil
+}
+
+func scheduleListCmd(ctx Ctx) (any, error) {
+	tw, err := listTweets(scheduledStatus)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tw, func(i, j int) bool {
+		a, b := deref(tw[i].ScheduledAt), deref(tw[j].ScheduledAt)
+		if a != b {
+			return a < b
+		}
+		return tw[i].ThreadPos < tw[j].ThreadPos
+	})
+	if !ctx.JSON {
+		if len(tw) == 0 {
+			fmt.Println("  No scheduled tweets")
+		} else {
+			fmt.Printf("\n  scheduled (%d)\n\n", len(tw))
+			for _, t := range tw {
+				p := t.Content
+				if weightedLength(p) > 50 {
+					p = truncateWeighted(p, 50) + "..."
+				}
+				fmt.Printf("  %s %s %s\n", deref(t.ScheduledAt), t.ID, p)
+			}
+			fmt.Println()
+		}
+	}
+	return map[string]any{"count": len(tw), "tweets": tw}, nil
+}
+
+func scheduleCancelCmd(id string, ctx Ctx) (any, error) {
+	t, err := getTweet(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, cliFail("NOT_FOUND", "Tweet not found: "+id, nil)
+	}
+	// Statuses are checked under the lock: a member the worker has claimed
+	// or posted since t was read must not go back to draft.
+	var out []Tweet
+	err = mutateTweets(func(v tweetView) ([]Tweet, error) {
+		targets, err := claimMembers(v, t)
+		if err != nil {
+			return nil, err
+		}
+		out = nil
+		status := t.Status
+		for _, it := range targets {
+			if it.ID == t.ID {
+				status = it.Status
+			}
+			switch it.Status {
+			case postingStatus:
+				return nil, cliFail("CONFLICT", "Being posted by the worker: "+it.ID, map[string]any{"id": it.ID})
+			case scheduledStatus:
+				it.Status = draftStatus
+				it.ScheduledAt = nil
+				out = append(out, it)
+			}
+		}
+		if len(out) == 0 {
+			return nil, cliFail("CONFLICT", "Not scheduled (current status: "+status+")", nil)
+		}
+		return out, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Cancelled schedule for %d tweet(s)\n", len(out))
+	}
+	return map[string]any{"action": "cancelled", "count": len(out), "tweets": out}, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
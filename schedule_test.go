@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWhen(t *testing.T) {
+	now := time.Date(2026, 3, 4, 15, 0, 0, 0, time.UTC) // Wednesday
+	cases := map[string]time.Time{
+		"2026-03-05T10:00:00Z": time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC),
+		"2026-03-05 08:30":     time.Date(2026, 3, 5, 8, 30, 0, 0, time.UTC),
+		"tomorrow 9am":         time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC),
+		"tomorrow":             time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC),
+		"today 5:30pm":         time.Date(2026, 3, 4, 17, 30, 0, 0, time.UTC),
+		"9am":                  time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC),
+		"18:00":                time.Date(2026, 3, 4, 18, 0, 0, 0, time.UTC),
+		"friday 12pm":          time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC),
+		"wednesday 8am":        time.Date(2026, 3, 11, 8, 0, 0, 0, time.UTC),
+		"in 2h":                time.Date(2026, 3, 4, 17, 0, 0, 0, time.UTC),
+	}
+	for in, want := range cases {
+		got, err := parseWhen(in, now)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("%q: got %s want %s", in, got, want)
+		}
+	}
+	for _, bad := range []string{"", "soon", "tomorrow 25:00", "13pm"} {
+		if _, err := parseWhen(bad, now); err == nil {
+			t.Fatalf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestScheduleThreadViaMember(t *testing.T) {
+	withTempCwd(t, func() {
+		tid := "thr1"
+		a, _ := createTweet("one", &tid, 0, nil)
+		b, _ := createTweet("two", &tid, 1, nil)
+		if _, err := scheduleCmd([]string{b.ID, "--at", "in", "1h"}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{a.ID, b.ID} {
+			got, _ := getTweet(id)
+			if got.Status != scheduledStatus || got.ScheduledAt == nil {
+				t.Fatalf("not scheduled: %+v", got)
+			}
+		}
+		if _, err := scheduleCmd([]string{"cancel", a.ID}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := getTweet(b.ID)
+		if got.Status != draftStatus || got.ScheduledAt != nil {
+			t.Fatalf("cancel failed: %+v", got)
+		}
+	})
+}
+
+func TestSchedulePartlyPostedThreadResumes(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		tid := "thr1"
+		a, _ := createTweet("one", &tid, 0, nil)
+		b, _ := createTweet("two", &tid, 1, nil)
+		c, _ := createTweet("three", &tid, 2, nil)
+		rid := "100"
+		_, _ = updateTweet(a.ID, func(x *Tweet) { x.Status, x.TweetID = postedStatus, &rid })
+		_, _ = updateTweet(b.ID, func(x *Tweet) { x.Status = failedStatus })
+		res, err := scheduleCmd([]string{a.ID, "--at", "in", "1h"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := res.(map[string]any)["count"]; n != 2 {
+			t.Fatalf("scheduled %v members, want 2", n)
+		}
+		if got, _ := getTweet(a.ID); got.Status != postedStatus || got.ScheduledAt != nil {
+			t.Fatalf("posted head touched: %+v", got)
+		}
+
+		past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		for _, id := range []string{b.ID, c.ID} {
+			_, _ = updateTweet(id, func(x *Tweet) { x.ScheduledAt = &past })
+		}
+		st := workerState{Interval: "30s"}
+		workerTick(twClient{dry: true, quiet: true}, &st, ctx)
+		if st.Posted != 1 || st.Failed != 0 {
+			t.Fatalf("posted=%d failed=%d last=%v", st.Posted, st.Failed, st.LastError)
+		}
+		for _, id := range []string{b.ID, c.ID} {
+			if got, _ := getTweet(id); got.Status != postedStatus {
+				t.Fatalf("not resumed: %+v", got)
+			}
+		}
+		if _, err := scheduleCmd([]string{a.ID, "--at", "in", "1h"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("fully posted err=%v", err)
+		}
+	})
+}
+
+func TestScheduleCancelLeavesClaimedTweets(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		tid := "thr1"
+		a, _ := createTweet("one", &tid, 0, nil)
+		b, _ := createTweet("two", &tid, 1, nil)
+		if _, err := scheduleCmd([]string{a.ID, "--at", "in", "1h"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		// The worker claims the thread after cancel has read it.
+		_, _ = updateTweet(b.ID, func(x *Tweet) { x.Status = postingStatus })
+		if _, err := scheduleCmd([]string{"cancel", a.ID}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("cancel while posting err=%v", err)
+		}
+		for id, want := range map[string]string{a.ID: scheduledStatus, b.ID: postingStatus} {
+			if got, _ := getTweet(id); got.Status != want {
+				t.Fatalf("%s status=%s want %s", id, got.Status, want)
+			}
+		}
+		_, _ = updateTweet(b.ID, func(x *Tweet) { x.Status = postedStatus })
+		res, err := scheduleCmd([]string{"cancel", a.ID}, ctx)
+		if err != nil || res.(map[string]any)["count"] != 1 {
+			t.Fatalf("cancel res=%v err=%v", res, err)
+		}
+		if got, _ := getTweet(b.ID); got.Status != postedStatus {
+			t.Fatalf("posted member changed: %+v", got)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// schemaVersion is the data layout this binary reads and writes. Bump it
+// together with a new entry in migrations whenever stored records change
+// shape; new optional fields that older binaries ignore do not need one.
+const schemaVersion = 2
+
+type migration struct {
+	Version int
+	Name    string
+	Tweet   func(map[string]any) bool
+	Gen     func(map[string]any) bool
+}
+
+// migrations upgrade raw records one version at a time; each func reports
+// whether it changed the record. Data written before versioning is version 0.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "normalize unversioned records",
+		Tweet: func(t map[string]any) bool {
+			changed := false
+			if s, _ := t["status"].(string); s == "" {
+				t["status"] = draftStatus
+				changed = true
+			}
+			if _, ok := t["thread_pos"]; !ok {
+				t["thread_pos"] = 0
+				changed = true
+			}
+			if s, _ := t["created_at"].(string); s == "" {
+				t["created_at"] = first(str(t["posted_at"]), time.Now().UTC().Format(time.RFC3339))
+				changed = true
+			}
+			return changed
+		},
+		Gen: func(g map[string]any) bool {
+			if s, _ := g["model"].(string); s == "" {
+				g["model"] = "template"
+				return true
+			}
+			return false
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add scheduled_at to tweets",
+		Tweet: func(t map[string]any) bool {
+			changed := false
+			if _, ok := t["scheduled_at"]; !ok {
+				t["scheduled_at"] = nil
+				changed = true
+			}
+			if t["status"] == scheduledStatus && t["scheduled_at"] == nil {
+				t["status"] = draftStatus
+				changed = true
+			}
+			return changed
+		},
+	},
+}
+
+type migrationStep struct {
+	Version     int    `json:"version"`
+	Name        string `json:"name"`
+	Tweets      int    `json:"tweets"`
+	Generations int    `json:"generations"`
+}
+
+type migrationReport struct {
+	From    int             `json:"from"`
+	To      int             `json:"to"`
+	Steps   []migrationStep `json:"steps"`
+	Backups []string        `json:"backups"`
+	DryRun  bool            `json:"dryRun"`
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// applyMigrations upgrades tweets and gens in place from version from to
+// schemaVersion and reports how many records each step touched.
+func applyMigrations(from int, tweets, gens []map[string]any) (migrationReport, error) {
+	rep := migrationReport{From: from, To: schemaVersion, Steps: []migrationStep{}, Backups: []string{}}
+	if from > schemaVersion {
+		return rep, cliFail("SCHEMA_TOO_NEW", fmt.Sprintf("Store schema version %d is newer than this xpostctl supports (%d); upgrade xpostctl", from, schemaVersion), map[string]any{"stored": from, "supported": schemaVersion})
+	}
+	for _, m := range migrations {
+		if m.Version <= from {
+			continue
+		}
+		st := migrationStep{Version: m.Version, Name: m.Name}
+		for _, t := range tweets {
+			if m.Tweet != nil && m.Tweet(t) {
+				st.Tweets++
+			}
+		}
+		for _, g := range gens {
+			if m.Gen != nil && m.Gen(g) {
+				st.Generations++
+			}
+		}
+		rep.Steps = append(rep.Steps, st)
+	}
+	return rep, nil
+}
+
+func metaPath() string { return filepath.Join(dataDir(), "meta.json") }
+
+type storeMeta struct {
+	SchemaVersion int    `json:"schema_version"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// ensureSchema brings a freshly opened store up to schemaVersion.
+func ensureSchema(s Store) error {
+	v, err := s.SchemaVersion()
+	if err != nil || v == schemaVersion {
+		return err
+	}
+	_, err = s.Migrate(false)
+	return err
+}
+
+func storeVersionCmd(ctx Ctx) (any, error) {
+	s, err := openBackendUnmigrated(storeBackend())
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	v, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	pending := []migrationStep{}
+	for _, m := range migrations {
+		if m.Version > v {
+			pending = append(pending, migrationStep{Version: m.Version, Name: m.Name})
+		}
+	}
+	if !ctx.JSON {
+		fmt.Printf("\n  backend: %s\n  schema: %d (supported: %d)\n", storeBackend(), v, schemaVersion)
+		for _, p := range pending {
+			fmt.Printf("  pending: v%d %s\n", p.Version, p.Name)
+		}
+		fmt.Println()
+	}
+	return map[string]any{"backend": storeBackend(), "schemaVersion": v, "supported": schemaVersion, "pending": pending}, nil
+}
+
+func storeSchemaMigrateCmd(dry bool, ctx Ctx) (any, error) {
+	s, err := openBackendUnmigrated(storeBackend())
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	rep, err := s.Migrate(dry)
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		switch {
+		case len(rep.Steps) == 0:
+			fmt.Printf("  Schema is up to date (v%d)\n", rep.To)
+		case dry:
+			fmt.Printf("  Would migrate v%d -> v%d:\n", rep.From, rep.To)
+		default:
+			fmt.Printf("  Migrated v%d -> v%d:\n", rep.From, rep.To)
+		}
+		for _, st := range rep.Steps {
+			fmt.Printf("    v%d %s (%d tweets, %d generations)\n", st.Version, st.Name, st.Tweets, st.Generations)
+		}
+		for _, b := range rep.Backups {
+			fmt.Println("  Backup:", b)
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const legacyTweets = `[
+  {"id":"a1","content":"old draft","thread_id":null,"status":"","tweet_id":null,"posted_at":null,"created_at":"2025-01-01T00:00:00Z","tags":null},
+  {"id":"a2","content":"stuck","thread_id":null,"thread_pos":0,"status":"scheduled","tweet_id":null,"posted_at":null,"created_at":"2025-01-02T00:00:00Z","tags":null}
+]`
+
+func TestStoreMigrateDryThenAutomatic(t *testing.T) {
+	withTempCwd(t, func() {
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(tweetsPath(), []byte(legacyTweets), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		res, err := storeCmd([]string{"migrate", "--dry"}, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep := res.(migrationReport)
+		if rep.From != 0 || len(rep.Steps) != schemaVersion || rep.Steps[0].Tweets != 1 || rep.Steps[1].Tweets != 2 {
+			t.Fatalf("dry report=%+v", rep)
+		}
+		raw, _ := os.ReadFile(tweetsPath())
+		if strings.Contains(string(raw), "scheduled_at") {
+			t.Fatal("dry run modified the store")
+		}
+
+		got, err := getTweet("a2")
+		if err != nil || got == nil {
+			t.Fatalf("get: %+v %v", got, err)
+		}
+		if got.Status != draftStatus {
+			t.Fatalf("status=%s", got.Status)
+		}
+		if old, _ := getTweet("a1"); old.Status != draftStatus {
+			t.Fatalf("a1 status=%s", old.Status)
+		}
+		if _, err := os.Stat(tweetsPath() + ".v0.bak"); err != nil {
+			t.Fatal(err)
+		}
+		s, _ := openStore()
+		if v, _ := s.SchemaVersion(); v != schemaVersion {
+			t.Fatalf("version=%d", v)
+		}
+	})
+}
+
+func TestNewerSchemaIsRefused(t *testing.T) {
+	withTempCwd(t, func() {
+		_ = ensureData()
+		_ = writeJSON(metaPath(), storeMeta{SchemaVersion: schemaVersion + 1})
+		_, err := listTweets("")
+		if ce, ok := err.(*CliErr); !ok || ce.Code != "SCHEMA_TOO_NEW" {
+			t.Fatalf("err=%v", err)
+		}
+	})
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+const (
+	keyringService = "xpostctl"
+	keyringBackend = "keyring"
+	fileBackend    = "file"
+)
+
+// pbkdf2Iterations is used for new secrets.enc files; existing ones record
+// their own count. Tests lower it.
+var pbkdf2Iterations = 600_000
+
+// secretStore keeps one profile's credentials, keyed by credVar.Key, outside
+// config.json. Load returns an empty map when nothing is stored; saving an
+// empty map removes the entry.
+type secretStore interface {
+	Name() string
+	Load() (map[string]string, error)
+	Save(map[string]string) error
+}
+
+func secretsPath() string { return filepath.Join(dataDir(), "secrets.enc") }
+
+// keyringUser is the keyring account for a profile. It includes a hash of
+// the profile's data dir so two data dirs with the same profile names keep
+// separate entries.
+func keyringUser(profile string) string {
+	dir := profileDir(profile)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return profile + "@" + hex.EncodeToString(sum[:6])
+}
+
+// keyringAvailable reports whether the OS keychain (Secret Service, macOS
+// Keychain, Windows Credential Manager) answers at all.
+func keyringAvailable() bool {
+	_, err := keyring.Get(keyringService, "probe")
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+}
+
+// openSecrets returns the store kind names. "" picks the keyring when one is
+// reachable and the encrypted file otherwise.
+func openSecrets(kind string) (secretStore, error) {
+	switch kind {
+	case "":
+		if keyringAvailable() {
+			return keyringSecrets{user: keyringUser(currentProfile())}, nil
+		}
+		return fileSecrets{path: secretsPath()}, nil
+	case keyringBackend:
+		if !keyringAvailable() {
+			return nil, cliFail("SECRETS_UNAVAILABLE", "No OS keyring is reachable; use --backend file", nil)
+		}
+		return keyringSecrets{user: keyringUser(currentProfile())}, nil
+	case fileBackend:
+		return fileSecrets{path: secretsPath()}, nil
+	default:
+		return nil, cliFail("INVALID_ARGS", "Unknown secrets backend: "+kind, map[string]any{"available": []string{keyringBackend, fileBackend}})
+	}
+}
+
+// storedSecrets loads the credentials auth set saved for the active profile,
+// or nothing when it never ran: loadConfig must not touch the keyring or ask
+// for a passphrase for users who keep their keys elsewhere.
+func storedSecrets(kind string) (map[string]string, error) {
+	if kind == "" {
+		if _, err := os.Stat(secretsPath()); err != nil {
+			return map[string]string{}, nil
+		}
+		kind = fileBackend
+	}
+	s, err := openSecrets(kind)
+	if err != nil {
+		return nil, err
+	}
+	return s.Load()
+}
+
+// keyringSecrets stores all of a profile's credentials as one JSON keyring
+// item, so a keychain that asks before each access asks once.
+type keyringSecrets struct{ user string }
+
+func (keyringSecrets) Name() string { return keyringBackend }
+
+func (k keyringSecrets) Load() (map[string]string, error) {
+	out := map[string]string{}
+	raw, err := keyring.Get(keyringService, k.user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, cliFail("SECRETS_UNAVAILABLE", "Reading the OS keyring failed: "+err.Error(), nil)
+	}
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, cliFail("INVALID_CONFIG", "The keyring entry "+k.user+" is not valid JSON", nil)
+	}
+	return out, nil
+}
+
+func (k keyringSecrets) Save(m map[string]string) error {
+	if len(m) == 0 {
+		if err := keyring.Delete(keyringService, k.user); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(keyringService, k.user, string(raw))
+}
+
+// fileSecrets is the fallback: secrets.enc in the profile's data dir, AES-GCM
+// under a key derived from XPOSTCTL_PASSPHRASE with PBKDF2-SHA256.
+type fileSecrets struct{ path string }
+
+type sealedSecrets struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func (fileSecrets) Name() string { return fileBackend }
+
+func (f fileSecrets) Load() (map[string]string, error) {
+	out := map[string]string{}
+	sealed, err := readJSON[*sealedSecrets](f.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if sealed == nil {
+		return out, nil
+	}
+	if sealed.KDF != "pbkdf2-sha256" {
+		return nil, cliFail("INVALID_CONFIG", "Unsupported key derivation in secrets.enc: "+sealed.KDF, nil)
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := secretsCipher(pass, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, sealed.Nonce, sealed.Data, nil)
+	if err != nil {
+		return nil, cliFail("SECRETS_LOCKED", "Cannot decrypt secrets.enc; wrong XPOSTCTL_PASSPHRASE?", map[string]any{"path": f.path})
+	}
+	if err := json.Unmarshal(plain, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Save writes secrets.enc without the .bak writeJSON keeps, so removed or
+// replaced credentials do not linger in a backup; it also deletes any .bak
+// an older version left behind.
+func (f fileSecrets) Save(m map[string]string) error {
+	if err := os.Remove(f.path + ".bak"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(m) == 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return err
+	}
+	sealed := sealedSecrets{KDF: "pbkdf2-sha256", Iterations: pbkdf2Iterations, Salt: make([]byte, 16)}
+	_, _ = rand.Read(sealed.Salt)
+	gcm, err := secretsCipher(pass, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return err
+	}
+	sealed.Nonce = make([]byte, gcm.NonceSize())
+	_, _ = rand.Read(sealed.Nonce)
+	plain, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sealed.Data = gcm.Seal(nil, sealed.Nonce, plain, nil)
+	raw, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(filepath.Dir(f.path), f.path, append(raw, '\n'), 0o600)
+}
+
+func secretsCipher(pass string, salt []byte, iter int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, pass, salt, iter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var (
+	stdinLines = bufio.NewReader(os.Stdin)
+	cachedPass string
+)
+
+// passphrase is XPOSTCTL_PASSPHRASE or asked for once per run: without echo
+// on a terminal, as the first line of stdin otherwise.
+func passphrase() (string, error) {
+	if p := os.Getenv("XPOSTCTL_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	if cachedPass != "" {
+		return cachedPass, nil
+	}
+	var p string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Passphrase for secrets.enc: ")
+		raw, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", cliFail("SECRETS_LOCKED", "Reading the passphrase failed: "+err.Error(), nil)
+		}
+		p = string(raw)
+	} else {
+		p, _ = readLine("")
+	}
+	if p == "" {
+		return "", cliFail("SECRETS_LOCKED", "Credentials are in secrets.enc; set XPOSTCTL_PASSPHRASE to unlock them", map[string]any{"path": secretsPath()})
+	}
+	cachedPass = p
+	return p, nil
+}
+
+func stdinIsTerminal() bool {
+	st, err := os.Stdin.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+func readLine(prompt string) (string, error) {
+	if stdinIsTerminal() {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := stdinLines.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// findCredVar accepts a credential by its config key (twitter.apiKey), the
+// last part of it (apiKey) or one of its env vars (X_API_KEY).
+func findCredVar(name string) (credVar, bool) {
+	for _, v := range credVars {
+		if strings.EqualFold(name, v.Key) || strings.EqualFold(name, v.Key[strings.Index(v.Key, ".")+1:]) {
+			return v, true
+		}
+		for _, e := range v.Env {
+			if strings.EqualFold(name, e) {
+				return v, true
+			}
+		}
+	}
+	return credVar{}, false
+}
+
+func credKeys() []string {
+	out := make([]string, 0, len(credVars))
+	for _, v := range credVars {
+		out = append(out, v.Key)
+	}
+	return out
+}
+
+// authSetCmd saves credentials to the keyring or secrets.enc and strips any
+// plaintext copy from config.json. --import moves whatever loadConfig
+// currently resolves (env, env files, config.json).
+func authSetCmd(args []string, ctx Ctx) (any, error) {
+	backend, importAll, unset := "", false, false
+	pos := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--backend" && i+1 < len(args):
+			backend = args[i+1]
+			i++
+		case args[i] == "--import":
+			importAll = true
+		case args[i] == "--unset":
+			unset = true
+		case strings.HasPrefix(args[i], "--"):
+			return nil, cliFail("INVALID_ARGS", "Unknown flag: "+args[i], nil)
+		default:
+			pos = append(pos, args[i])
+		}
+	}
+	usage := cliFail("INVALID_ARGS", "Usage: tweet auth set <key> [value] | --import | <key> --unset [--backend keyring|file]", map[string]any{"keys": credKeys()})
+	if importAll == (len(pos) > 0) || len(pos) > 2 || (unset && len(pos) != 1) {
+		return nil, usage
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	st, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	file, _, err := st.LoadConfig(Config{})
+	if err != nil {
+		return nil, err
+	}
+	prev, err := storedSecrets(file.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openSecrets(first(backend, file.Secrets, fileBackendIfPresent()))
+	if err != nil {
+		return nil, err
+	}
+	secrets := map[string]string{}
+	for k, v := range prev {
+		secrets[k] = v
+	}
+	changed := []string{}
+	if importAll {
+		for _, v := range credVars {
+			if x := *v.field(&cfg); x != "" {
+				secrets[v.Key] = x
+				changed = append(changed, v.Key)
+			}
+		}
+		if len(changed) == 0 {
+			return nil, cliFail("INVALID_ARGS", "No credentials to import; set them in the env or config.json first", nil)
+		}
+	} else {
+		v, ok := findCredVar(pos[0])
+		if !ok {
+			return nil, cliFail("INVALID_ARGS", "Unknown credential: "+pos[0], map[string]any{"keys": credKeys()})
+		}
+		switch {
+		case unset:
+			delete(secrets, v.Key)
+		case len(pos) == 2:
+			secrets[v.Key] = pos[1]
+		default:
+			x, err := readLine("Value for " + v.Key + ": ")
+			if err != nil || strings.TrimSpace(x) == "" {
+				return nil, cliFail("INVALID_ARGS", "No value given for "+v.Key, nil)
+			}
+			secrets[v.Key] = strings.TrimSpace(x)
+		}
+		changed = append(changed, v.Key)
+	}
+	if err := store.Save(secrets); err != nil {
+		return nil, err
+	}
+	if prev := first(file.Secrets, fileBackendIfPresent()); prev != "" && prev != store.Name() {
+		if old, err := openSecrets(prev); err == nil {
+			_ = old.Save(nil)
+		}
+	}
+	err = withLock(func() error {
+		raw, err := readJSON(cfgPath(), map[string]any{})
+		if err != nil {
+			return err
+		}
+		stripCreds(raw)
+		raw["secrets"] = store.Name()
+		if len(secrets) == 0 {
+			delete(raw, "secrets")
+		}
+		if err := writeJSON(cfgPath(), raw); err != nil {
+			return err
+		}
+		return scrubConfigBackups()
+	})
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]string, 0, len(secrets))
+	for k := range secrets {
+		stored = append(stored, k)
+	}
+	sort.Strings(stored)
+	if !ctx.JSON {
+		verb := "Stored"
+		if unset {
+			verb = "Removed"
+		}
+		fmt.Printf("  %s %s in the %s\n", verb, strings.Join(changed, ", "), describeSecrets(store.Name()))
+		fmt.Println("  config.json holds no credentials")
+	}
+	return map[string]any{"backend": store.Name(), "changed": changed, "stored": stored}, nil
+}
+
+// stripCreds deletes the credential keys from a raw config and reports
+// whether there were any.
+func stripCreds(raw map[string]any) bool {
+	found := false
+	for _, v := range credVars {
+		parts := strings.SplitN(v.Key, ".", 2)
+		if sec, ok := raw[parts[0]].(map[string]any); ok {
+			if _, ok := sec[parts[1]]; ok {
+				delete(sec, parts[1])
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// configBackups lists the copies of config.json writeFileAtomic leaves
+// behind (config.json.bak and any older *.bak).
+func configBackups() []string {
+	entries, _ := os.ReadDir(filepath.Dir(cfgPath()))
+	base := filepath.Base(cfgPath())
+	var out []string
+	for _, e := range entries {
+		if n := e.Name(); !e.IsDir() && strings.HasPrefix(n, base+".") && strings.HasSuffix(n, ".bak") {
+			out = append(out, filepath.Join(filepath.Dir(cfgPath()), n))
+		}
+	}
+	return out
+}
+
+// plaintextCreds lists the credential keys set in the config file at path.
+func plaintextCreds(path string) []string {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var c Config
+	if json.Unmarshal(raw, &c) != nil {
+		return nil
+	}
+	var out []string
+	for _, v := range credVars {
+		if *v.field(&c) != "" {
+			out = append(out, v.Key)
+		}
+	}
+	return out
+}
+
+// scrubConfigBackups removes credentials from the config.json backups, so
+// moving them out of config.json does not leave a plaintext copy next to
+// it. A backup that does not parse is deleted.
+func scrubConfigBackups() error {
+	for _, path := range configBackups() {
+		var raw map[string]any
+		prev, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if json.Unmarshal(prev, &raw) != nil || raw == nil {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		if !stripCreds(raw) {
+			continue
+		}
+		out, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := replaceFile(filepath.Dir(path), path, append(out, '\n'), 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fileBackendIfPresent() string {
+	if _, err := os.Stat(secretsPath()); err == nil {
+		return fileBackend
+	}
+	return ""
+}
+
+func describeSecrets(kind string) string {
+	if kind == keyringBackend {
+		return "OS keyring"
+	}
+	return "encrypted file " + secretsPath()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func clearCredEnv(t *testing.T) {
+	for _, v := range credVars {
+		for _, k := range v.Env {
+			t.Setenv(k, "")
+		}
+	}
+}
+
+func TestAuthSetImportsIntoEncryptedFile(t *testing.T) {
+	withTempCwd(t, func() {
+		clearCredEnv(t)
+		prev := pbkdf2Iterations
+		pbkdf2Iterations = 1000
+		t.Cleanup(func() { pbkdf2Iterations = prev })
+		t.Setenv("XPOSTCTL_PASSPHRASE", "correct horse")
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfgPath(), []byte(`{"twitter":{"apiKey":"key-123","apiSecret":"secret-456"},"ai":{"tone":"dry"}}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := authSetCmd([]string{"--import", "--backend", "file"}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := os.ReadFile(cfgPath())
+		if bytes.Contains(raw, []byte("key-123")) || bytes.Contains(raw, []byte("secret-456")) || !bytes.Contains(raw, []byte(`"secrets": "file"`)) || !bytes.Contains(raw, []byte(`"dry"`)) {
+			t.Fatalf("config.json=%s", raw)
+		}
+		if bak, err := os.ReadFile(cfgPath() + ".bak"); err != nil || bytes.Contains(bak, []byte("key-123")) || !bytes.Contains(bak, []byte(`"dry"`)) {
+			t.Fatalf("config.json.bak=%s err=%v", bak, err)
+		}
+		enc, _ := os.ReadFile(secretsPath())
+		if len(enc) == 0 || bytes.Contains(enc, []byte("secret-456")) {
+			t.Fatalf("secrets.enc=%s", enc)
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Twitter.APIKey != "key-123" || cfg.Twitter.APISecret != "secret-456" {
+			t.Fatalf("twitter=%+v", cfg.Twitter)
+		}
+		t.Setenv("X_API_KEY", "from-env")
+		if cfg, _ := loadConfig(); cfg.Twitter.APIKey != "from-env" {
+			t.Fatalf("env should win, got %q", cfg.Twitter.APIKey)
+		}
+
+		t.Setenv("X_API_KEY", "")
+		if _, err := authSetCmd([]string{"apiSecret", "rotated-789"}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(secretsPath() + ".bak"); !os.IsNotExist(err) {
+			t.Fatalf("secrets.enc.bak holds the old credentials: %v", err)
+		}
+
+		t.Setenv("XPOSTCTL_PASSPHRASE", "wrong")
+		if _, err := loadConfig(); err == nil || err.(*CliErr).Code != "SECRETS_LOCKED" {
+			t.Fatalf("err=%v", err)
+		}
+		if err := os.WriteFile(secretsPath()+".bak", enc, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := (fileSecrets{path: secretsPath()}).Save(nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{secretsPath(), secretsPath() + ".bak"} {
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
+				t.Fatalf("%s left after Save(nil): %v", p, err)
+			}
+		}
+	})
+}
+
+func TestAuthSetUsesKeyring(t *testing.T) {
+	keyring.MockInit()
+	withTempCwd(t, func() {
+		clearCredEnv(t)
+		ctx := Ctx{JSON: true}
+		res, err := authSetCmd([]string{"X_ACCESS_TOKEN", "tok-789"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.(map[string]any)["backend"] != keyringBackend {
+			t.Fatalf("res=%v", res)
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Twitter.AccessToken != "tok-789" || cfg.Secrets != keyringBackend {
+			t.Fatalf("cfg=%+v", cfg)
+		}
+		if err := (fileConfig{}).SaveConfig(cfg); err != nil {
+			t.Fatal(err)
+		}
+		if raw, _ := os.ReadFile(cfgPath()); bytes.Contains(raw, []byte("tok-789")) {
+			t.Fatalf("SaveConfig wrote a credential: %s", raw)
+		}
+
+		if _, err := authSetCmd([]string{"accessToken", "--unset"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keyring.Get(keyringService, keyringUser(defaultProfile)); err != keyring.ErrNotFound {
+			t.Fatalf("keyring entry left behind: %v", err)
+		}
+		if cfg, _ := loadConfig(); cfg.Twitter.AccessToken != "" || cfg.Secrets != "" {
+			t.Fatalf("cfg=%+v", cfg)
+		}
+		if _, err := authSetCmd([]string{"nope", "x"}, ctx); err == nil || err.(*CliErr).Code != "INVALID_ARGS" {
+			t.Fatalf("err=%v", err)
+		}
+	})
+}
+
+func TestKeyringUserIsPerDataDir(t *testing.T) {
+	t.Setenv("XPOSTCTL_DATA_DIR", t.TempDir())
+	a := keyringUser(defaultProfile)
+	t.Setenv("XPOSTCTL_DATA_DIR", t.TempDir())
+	if b := keyringUser(defaultProfile); a == b {
+		t.Fatalf("same keyring user %q for two data dirs", a)
+	}
+}
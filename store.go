@@ -0,0 +1,588 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is the persistence backend for tweets, generation history and config.
+// The JSON files in the data directory are the default; SQLite is selected
+// with XPOSTCTL_STORE or the "store" key in config.json.
+type Store interface {
+	// ListTweets returns tweets with the given status ("" for all), newest first.
+	ListTweets(status string) ([]Tweet, error)
+	GetTweet(id string) (*Tweet, error)
+	// ThreadTweets returns the members of a thread ordered by position.
+	ThreadTweets(threadID string) ([]Tweet, error)
+	// PutTweets inserts the tweets, replacing any with the same ID.
+	PutTweets(items ...Tweet) error
+	// UpdateTweet applies fn atomically; it returns nil if id does not exist.
+	UpdateTweet(id string, fn func(*Tweet)) (*Tweet, error)
+	// MutateTweets runs fn under the store lock with a view of the current
+	// tweets and saves the tweets it returns, replacing any with the same ID.
+	// Nothing is written when fn fails.
+	MutateTweets(fn func(tweetView) ([]Tweet, error)) error
+	DeleteTweet(id string) error
+	// ListGens returns generation history, oldest first.
+	ListGens() ([]Gen, error)
+	// PutGens inserts the generations, replacing any with the same ID.
+	PutGens(items ...Gen) error
+	// UpdateGen applies fn atomically; it returns nil if id does not exist
+	// and writes nothing when fn fails.
+	UpdateGen(id string, fn func(*Gen) error) (*Gen, error)
+	// DeleteGens removes the generations with the given IDs.
+	DeleteGens(ids ...string) error
+	// Snapshot runs fn with every tweet and generation while other writers
+	// are held off, so nothing written meanwhile is missed.
+	Snapshot(fn func([]Tweet, []Gen) error) error
+	// ReplaceAll makes tweets and gens the store's entire contents.
+	ReplaceAll(tweets []Tweet, gens []Gen) error
+	// LoadConfig overlays the stored config on fallback and reports whether
+	// one was stored at all.
+	LoadConfig(fallback Config) (Config, bool, error)
+	SaveConfig(c Config) error
+	// SchemaVersion reports the version recorded in the store's metadata.
+	SchemaVersion() (int, error)
+	// Migrate upgrades stored records to schemaVersion, backing them up
+	// first; with dry set it only reports what would change.
+	Migrate(dry bool) (migrationReport, error)
+	Close() error
+}
+
+const (
+	jsonBackend   = "json"
+	sqliteBackend = "sqlite"
+)
+
+var storeBackends = []string{jsonBackend, sqliteBackend}
+
+// storeBackend resolves the configured backend. config.json is always a plain
+// file, even with SQLite, because it is where the backend choice lives.
+func storeBackend() string {
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("XPOSTCTL_STORE"))); v != "" {
+		return v
+	}
+	c, _ := readJSON(cfgPath(), struct {
+		Store string `json:"store"`
+	}{})
+	if v := strings.ToLower(strings.TrimSpace(c.Store)); v != "" {
+		return v
+	}
+	return jsonBackend
+}
+
+var (
+	storeMu sync.Mutex
+	stores  = map[string]Store{}
+)
+
+func openStore() (Store, error) {
+	if err := ensureData(); err != nil {
+		return nil, err
+	}
+	return openBackend(storeBackend())
+}
+
+// openBackend returns the (cached) store of the given kind for the current
+// data directory.
+func openBackend(kind string) (Store, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	key := kind + "|" + dataDir()
+	if s, ok := stores[key]; ok {
+		return s, nil
+	}
+	s, err := openBackendUnmigrated(kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureSchema(s); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	stores[key] = s
+	return s, nil
+}
+
+// openBackendUnmigrated opens a store without upgrading its schema, for
+// commands that only inspect it. The caller closes it.
+func openBackendUnmigrated(kind string) (Store, error) {
+	if err := ensureData(); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case jsonBackend:
+		return jsonStore{}, nil
+	case sqliteBackend:
+		return openSQLite(sqlitePath())
+	default:
+		return nil, cliFail("INVALID_CONFIG", "Unknown store backend: "+kind, map[string]any{"available": storeBackends})
+	}
+}
+
+func closeStores() {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	for k, s := range stores {
+		_ = s.Close()
+		delete(stores, k)
+	}
+}
+
+// fileConfig keeps config in config.json; both backends share it.
+type fileConfig struct{}
+
+func (fileConfig) LoadConfig(fallback Config) (Config, bool, error) {
+	_, err := os.Stat(cfgPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return fallback, false, nil
+	}
+	if err != nil {
+		return fallback, false, err
+	}
+	c, err := readJSON(cfgPath(), fallback)
+	if err != nil {
+		return fallback, true, nil
+	}
+	return c, true, nil
+}
+
+// SaveConfig never writes credentials; they belong in the env or auth set.
+func (fileConfig) SaveConfig(c Config) error {
+	for _, v := range credVars {
+		*v.field(&c) = ""
+	}
+	if err := writeJSON(cfgPath(), c); err != nil {
+		return err
+	}
+	return scrubConfigBackups()
+}
+
+// jsonStore keeps everything in JSON files under dataDir(). Reads are
+// lock-free because writes are atomic; read-modify-write holds the store lock.
+type jsonStore struct{ fileConfig }
+
+func (jsonStore) readTweets() ([]Tweet, error) {
+	all, err := readJSON(tweetsPath(), []Tweet{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].CreatedAt > all[j].CreatedAt })
+	return all, nil
+}
+
+func (s jsonStore) ListTweets(status string) ([]Tweet, error) {
+	all, err := s.readTweets()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Tweet, 0, len(all))
+	for _, t := range all {
+		if status == "" || t.Status == status {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (s jsonStore) GetTweet(id string) (*Tweet, error) {
+	all, err := s.readTweets()
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].ID == id {
+			c := all[i]
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s jsonStore) ThreadTweets(id string) ([]Tweet, error) {
+	all, err := s.readTweets()
+	if err != nil {
+		return nil, err
+	}
+	out := []Tweet{}
+	for _, t := range all {
+		if t.ThreadID != nil && *t.ThreadID == id {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ThreadPos < out[j].ThreadPos })
+	return out, nil
+}
+
+func (s jsonStore) PutTweets(items ...Tweet) error {
+	return s.MutateTweets(func(tweetView) ([]Tweet, error) { return items, nil })
+}
+
+// tweetView is what MutateTweets callbacks read from: the tweets as of the
+// lock, not a snapshot taken before it.
+type tweetView interface {
+	GetTweet(id string) (*Tweet, error)
+	// ThreadTweets returns the members of a thread ordered by position.
+	ThreadTweets(threadID string) ([]Tweet, error)
+}
+
+// memTweets is the JSON store's tweetView.
+type memTweets []Tweet
+
+func (m memTweets) GetTweet(id string) (*Tweet, error) {
+	for _, t := range m {
+		if t.ID == id {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m memTweets) ThreadTweets(id string) ([]Tweet, error) {
+	out := []Tweet{}
+	for _, t := range m {
+		if t.ThreadID != nil && *t.ThreadID == id {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ThreadPos < out[j].ThreadPos })
+	return out, nil
+}
+
+func (s jsonStore) MutateTweets(fn func(tweetView) ([]Tweet, error)) error {
+	return withLock(func() error {
+		all, err := s.readTweets()
+		if err != nil {
+			return err
+		}
+		items, err := fn(memTweets(all))
+		if err != nil {
+			return err
+		}
+		idx := make(map[string]int, len(all))
+		for i, t := range all {
+			idx[t.ID] = i
+		}
+		for _, t := range items {
+			if i, ok := idx[t.ID]; ok {
+				all[i] = t
+				continue
+			}
+			idx[t.ID] = len(all)
+			all = append(all, t)
+		}
+		return writeJSON(tweetsPath(), all)
+	})
+}
+
+func (s jsonStore) UpdateTweet(id string, fn func(*Tweet)) (*Tweet, error) {
+	var out *Tweet
+	err := withLock(func() error {
+		all, err := s.readTweets()
+		if err != nil {
+			return err
+		}
+		for i := range all {
+			if all[i].ID == id {
+				fn(&all[i])
+				if err := writeJSON(tweetsPath(), all); err != nil {
+					return err
+				}
+				c := all[i]
+				out = &c
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s jsonStore) DeleteTweet(id string) error {
+	return withLock(func() error {
+		all, err := s.readTweets()
+		if err != nil {
+			return err
+		}
+		out := make([]Tweet, 0, len(all))
+		for _, t := range all {
+			if t.ID != id {
+				out = append(out, t)
+			}
+		}
+		return writeJSON(tweetsPath(), out)
+	})
+}
+
+func (jsonStore) ListGens() ([]Gen, error) { return readJSON(gensPath(), []Gen{}) }
+
+func (jsonStore) PutGens(items ...Gen) error {
+	return withLock(func() error {
+		all, err := readJSON(gensPath(), []Gen{})
+		if err != nil {
+			return err
+		}
+		idx := make(map[string]int, len(all))
+		for i, g := range all {
+			idx[g.ID] = i
+		}
+		for _, g := range items {
+			if i, ok := idx[g.ID]; ok {
+				all[i] = g
+				continue
+			}
+			idx[g.ID] = len(all)
+			all = append(all, g)
+		}
+		return writeJSON(gensPath(), all)
+	})
+}
+
+func (jsonStore) UpdateGen(id string, fn func(*Gen) error) (*Gen, error) {
+	var out *Gen
+	err := withLock(func() error {
+		all, err := readJSON(gensPath(), []Gen{})
+		if err != nil {
+			return err
+		}
+		for i := range all {
+			if all[i].ID == id {
+				if err := fn(&all[i]); err != nil {
+					return err
+				}
+				if err := writeJSON(gensPath(), all); err != nil {
+					return err
+				}
+				g := all[i]
+				out = &g
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s jsonStore) Snapshot(fn func([]Tweet, []Gen) error) error {
+	return withLock(func() error {
+		tw, err := s.readTweets()
+		if err != nil {
+			return err
+		}
+		gens, err := readJSON(gensPath(), []Gen{})
+		if err != nil {
+			return err
+		}
+		return fn(tw, gens)
+	})
+}
+
+func (jsonStore) ReplaceAll(tweets []Tweet, gens []Gen) error {
+	return withLock(func() error {
+		if err := writeJSON(tweetsPath(), tweets); err != nil {
+			return err
+		}
+		return writeJSON(gensPath(), gens)
+	})
+}
+
+func (jsonStore) DeleteGens(ids ...string) error {
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	return withLock(func() error {
+		all, err := readJSON(gensPath(), []Gen{})
+		if err != nil {
+			return err
+		}
+		out := make([]Gen, 0, len(all))
+		for _, g := range all {
+			if !drop[g.ID] {
+				out = append(out, g)
+			}
+		}
+		return writeJSON(gensPath(), out)
+	})
+}
+
+func (jsonStore) SchemaVersion() (int, error) {
+	m, err := readJSON(metaPath(), storeMeta{})
+	return m.SchemaVersion, err
+}
+
+func (s jsonStore) Migrate(dry bool) (migrationReport, error) {
+	var rep migrationReport
+	err := withLock(func() error {
+		from, err := s.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		tweets, err := readJSON(tweetsPath(), []map[string]any{})
+		if err != nil {
+			return err
+		}
+		gens, err := readJSON(gensPath(), []map[string]any{})
+		if err != nil {
+			return err
+		}
+		rep, err = applyMigrations(from, tweets, gens)
+		rep.DryRun = dry
+		if err != nil || dry || from == schemaVersion {
+			return err
+		}
+		for path, records := range map[string][]map[string]any{tweetsPath(): tweets, gensPath(): gens} {
+			prev, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			bak := fmt.Sprintf("%s.v%d.bak", path, from)
+			if err := replaceFile(dataDir(), bak, prev, 0o600); err != nil {
+				return err
+			}
+			rep.Backups = append(rep.Backups, bak)
+			if err := writeJSON(path, records); err != nil {
+				return err
+			}
+		}
+		sort.Strings(rep.Backups)
+		return writeJSON(metaPath(), storeMeta{SchemaVersion: schemaVersion, UpdatedAt: time.Now().UTC().Format(time.RFC3339)})
+	})
+	return rep, err
+}
+
+func (jsonStore) Close() error { return nil }
+
+func storeCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) > 0 && args[0] == "version" {
+		return storeVersionCmd(ctx)
+	}
+	if len(args) > 0 && args[0] == "migrate" {
+		for _, a := range args[1:] {
+			if a == "--to" || strings.HasPrefix(a, "--to=") {
+				return storeMigrateCmd(args[1:], ctx)
+			}
+		}
+		return storeSchemaMigrateCmd(hasFlag(args, "--dry"), ctx)
+	}
+	if len(args) > 0 && args[0] != "info" {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet store [info|version|migrate [--dry]|migrate --to <json|sqlite>]", nil)
+	}
+	s, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	tw, err := s.ListTweets("")
+	if err != nil {
+		return nil, err
+	}
+	gens, err := s.ListGens()
+	if err != nil {
+		return nil, err
+	}
+	kind := storeBackend()
+	path := tweetsPath()
+	if kind == sqliteBackend {
+		path = sqlitePath()
+	}
+	if !ctx.JSON {
+		fmt.Printf("\n  backend: %s\n  path: %s\n  tweets: %d\n  generations: %d\n\n", kind, path, len(tw), len(gens))
+	}
+	return map[string]any{"backend": kind, "path": path, "tweets": len(tw), "generations": len(gens)}, nil
+}
+
+// storeMigrateCmd copies tweets and generations from the active backend into
+// another one and switches config.json over to it. The source is left intact
+// and held locked until the switch, so no write in between is lost. A
+// destination that already holds data needs --force, which replaces it.
+func storeMigrateCmd(args []string, ctx Ctx) (any, error) {
+	to, force := "", false
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--to" && i+1 < len(args) {
+			to = strings.ToLower(args[i+1])
+			i++
+		} else if strings.HasPrefix(args[i], "--to=") {
+			to = strings.ToLower(strings.TrimPrefix(args[i], "--to="))
+		} else if args[i] == "--force" {
+			force = true
+		}
+	}
+	if to == "" {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet store migrate --to <json|sqlite> [--force]", map[string]any{"available": storeBackends})
+	}
+	from := storeBackend()
+	if from == to {
+		return nil, cliFail("CONFLICT", "Already using the "+to+" backend", nil)
+	}
+	src, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	dst, err := openBackend(to)
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		tw, err := dst.ListTweets("")
+		if err != nil {
+			return nil, err
+		}
+		gens, err := dst.ListGens()
+		if err != nil {
+			return nil, err
+		}
+		if len(tw) > 0 || len(gens) > 0 {
+			return nil, cliFail("CONFLICT", fmt.Sprintf("The %s store already holds %d tweets and %d generations; --force replaces them", to, len(tw), len(gens)), map[string]any{"tweets": len(tw), "generations": len(gens), "hint": "tweet store migrate --to " + to + " --force"})
+		}
+	}
+	cfg, _, err := src.LoadConfig(defaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	var plain []string
+	for _, v := range credVars {
+		if *v.field(&cfg) != "" {
+			plain = append(plain, v.Key)
+		}
+	}
+	if len(plain) > 0 {
+		return nil, cliFail("CONFLICT", "config.json holds "+strings.Join(plain, ", ")+"; move them with `xpostctl auth set --import` before migrating", map[string]any{"keys": plain})
+	}
+	var nTweets, nGens int
+	err = src.Snapshot(func(tw []Tweet, gens []Gen) error {
+		if err := dst.ReplaceAll(tw, gens); err != nil {
+			return err
+		}
+		nTweets, nGens = len(tw), len(gens)
+		cfg, _, err := src.LoadConfig(defaultConfig())
+		if err != nil {
+			return err
+		}
+		cfg.Store = to
+		return src.SaveConfig(cfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Migrated %d tweets and %d generations from %s to %s\n", nTweets, nGens, from, to)
+		if os.Getenv("XPOSTCTL_STORE") != "" {
+			fmt.Println("  Note: XPOSTCTL_STORE is set and overrides config.json")
+		}
+	}
+	return map[string]any{"from": from, "to": to, "tweets": nTweets, "generations": nGens}, nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func sqlitePath() string { return filepath.Join(dataDir(), "xpostctl.db") }
+
+// Rows keep the full record as JSON in data so new Tweet/Gen fields need no
+// schema change; the other columns exist only to be indexed.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tweets (
+	id         TEXT PRIMARY KEY,
+	status     TEXT NOT NULL,
+	thread_id  TEXT,
+	thread_pos INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tweets_status ON tweets(status);
+CREATE INDEX IF NOT EXISTS tweets_thread ON tweets(thread_id, thread_pos);
+CREATE INDEX IF NOT EXISTS tweets_created ON tweets(created_at);
+CREATE TABLE IF NOT EXISTS generations (
+	id         TEXT PRIMARY KEY,
+	created_at TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS generations_created ON generations(created_at);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+type sqliteStore struct {
+	fileConfig
+	db   *sql.DB
+	path string
+}
+
+func openSQLite(path string) (*sqliteStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_txlock=immediate", filepath.ToSlash(path), lockTimeout().Milliseconds())
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, sqliteErr(err)
+	}
+	_ = os.Chmod(path, 0o600)
+	return &sqliteStore{db: db, path: path}, nil
+}
+
+// sqliteErr surfaces SQLITE_BUSY the same way the JSON store reports a held
+// lock file.
+func sqliteErr(err error) error {
+	var se *sqlite.Error
+	if errors.As(err, &se) && se.Code()&0xff == sqlite3.SQLITE_BUSY {
+		return cliFail("LOCKED", "Tweet store is locked by another xpostctl process", map[string]any{"lockFile": sqlitePath(), "waited": lockTimeout().String()})
+	}
+	return err
+}
+
+type sqlQuerier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func (s *sqliteStore) queryTweets(q string, args ...any) ([]Tweet, error) {
+	return queryTweets(s.db, q, args...)
+}
+
+func queryTweets(db sqlQuerier, q string, args ...any) ([]Tweet, error) {
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, sqliteErr(err)
+	}
+	defer rows.Close()
+	out := []Tweet{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var t Tweet
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, sqliteErr(rows.Err())
+}
+
+func (s *sqliteStore) ListTweets(status string) ([]Tweet, error) {
+	if status == "" {
+		return s.queryTweets(`SELECT data FROM tweets ORDER BY created_at DESC`)
+	}
+	return s.queryTweets(`SELECT data FROM tweets WHERE status = ? ORDER BY created_at DESC`, status)
+}
+
+func (s *sqliteStore) GetTweet(id string) (*Tweet, error) {
+	out, err := s.queryTweets(`SELECT data FROM tweets WHERE id = ?`, id)
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+	return &out[0], nil
+}
+
+func (s *sqliteStore) ThreadTweets(id string) ([]Tweet, error) {
+	return s.queryTweets(`SELECT data FROM tweets WHERE thread_id = ? ORDER BY thread_pos`, id)
+}
+
+// txTweets is the SQLite tweetView: reads inside the write transaction.
+type txTweets struct{ tx *sql.Tx }
+
+func (v txTweets) GetTweet(id string) (*Tweet, error) {
+	out, err := queryTweets(v.tx, `SELECT data FROM tweets WHERE id = ?`, id)
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+	return &out[0], nil
+}
+
+func (v txTweets) ThreadTweets(id string) ([]Tweet, error) {
+	return queryTweets(v.tx, `SELECT data FROM tweets WHERE thread_id = ? ORDER BY thread_pos`, id)
+}
+
+func (s *sqliteStore) MutateTweets(fn func(tweetView) ([]Tweet, error)) error {
+	return s.tx(func(tx *sql.Tx) error {
+		items, err := fn(txTweets{tx})
+		if err != nil {
+			return err
+		}
+		for _, t := range items {
+			if err := putTweet(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func putTweet(x sqlExecer, t Tweet) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = x.Exec(`INSERT OR REPLACE INTO tweets (id, status, thread_id, thread_pos, created_at, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Status, t.ThreadID, t.ThreadPos, t.CreatedAt, string(raw))
+	return err
+}
+
+func (s *sqliteStore) PutTweets(items ...Tweet) error {
+	return s.tx(func(tx *sql.Tx) error {
+		for _, t := range items {
+			if err := putTweet(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) UpdateTweet(id string, fn func(*Tweet)) (*Tweet, error) {
+	var out *Tweet
+	err := s.tx(func(tx *sql.Tx) error {
+		var raw string
+		err := tx.QueryRow(`SELECT data FROM tweets WHERE id = ?`, id).Scan(&raw)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var t Tweet
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return err
+		}
+		fn(&t)
+		if err := putTweet(tx, t); err != nil {
+			return err
+		}
+		out = &t
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *sqliteStore) DeleteTweet(id string) error {
+	_, err := s.db.Exec(`DELETE FROM tweets WHERE id = ?`, id)
+	return sqliteErr(err)
+}
+
+func (s *sqliteStore) ListGens() ([]Gen, error) { return queryGens(s.db) }
+
+func queryGens(db sqlQuerier) ([]Gen, error) {
+	rows, err := db.Query(`SELECT data FROM generations ORDER BY created_at`)
+	if err != nil {
+		return nil, sqliteErr(err)
+	}
+	defer rows.Close()
+	out := []Gen{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var g Gen
+		if err := json.Unmarshal([]byte(raw), &g); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, sqliteErr(rows.Err())
+}
+
+func (s *sqliteStore) PutGens(items ...Gen) error {
+	return s.tx(func(tx *sql.Tx) error {
+		for _, g := range items {
+			raw, err := json.Marshal(g)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO generations (id, created_at, data) VALUES (?, ?, ?)`, g.ID, g.CreatedAt, string(raw)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) UpdateGen(id string, fn func(*Gen) error) (*Gen, error) {
+	var out *Gen
+	err := s.tx(func(tx *sql.Tx) error {
+		var raw string
+		err := tx.QueryRow(`SELECT data FROM generations WHERE id = ?`, id).Scan(&raw)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var g Gen
+		if err := json.Unmarshal([]byte(raw), &g); err != nil {
+			return err
+		}
+		if err := fn(&g); err != nil {
+			return err
+		}
+		b, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE generations SET data = ? WHERE id = ?`, string(b), id); err != nil {
+			return err
+		}
+		out = &g
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Snapshot reads inside an immediate transaction, so no other process can
+// write until fn returns.
+func (s *sqliteStore) Snapshot(fn func([]Tweet, []Gen) error) error {
+	return s.tx(func(tx *sql.Tx) error {
+		tw, err := queryTweets(tx, `SELECT data FROM tweets ORDER BY created_at DESC`)
+		if err != nil {
+			return err
+		}
+		gens, err := queryGens(tx)
+		if err != nil {
+			return err
+		}
+		return fn(tw, gens)
+	})
+}
+
+func (s *sqliteStore) ReplaceAll(tweets []Tweet, gens []Gen) error {
+	return s.tx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM tweets; DELETE FROM generations`); err != nil {
+			return err
+		}
+		for _, t := range tweets {
+			if err := putTweet(tx, t); err != nil {
+				return err
+			}
+		}
+		for _, g := range gens {
+			raw, err := json.Marshal(g)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO generations (id, created_at, data) VALUES (?, ?, ?)`, g.ID, g.CreatedAt, string(raw)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) DeleteGens(ids ...string) error {
+	return s.tx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec(`DELETE FROM generations WHERE id = ?`, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) SchemaVersion() (int, error) {
+	var v string
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'schema_version'`).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, sqliteErr(err)
+	}
+	return strconv.Atoi(v)
+}
+
+func queryRaw(tx *sql.Tx, q string) ([]map[string]any, error) {
+	rows, err := tx.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []map[string]any{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		m := map[string]any{}
+		if err := json.Unmarshal([]byte(raw), &m); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) Migrate(dry bool) (migrationReport, error) {
+	from, err := s.SchemaVersion()
+	if err != nil {
+		return migrationReport{}, err
+	}
+	if !dry && from < schemaVersion {
+		var n int
+		if err := s.db.QueryRow(`SELECT (SELECT COUNT(*) FROM tweets) + (SELECT COUNT(*) FROM generations)`).Scan(&n); err != nil {
+			return migrationReport{}, sqliteErr(err)
+		}
+		if n > 0 {
+			bak := fmt.Sprintf("%s.v%d.bak", s.path, from)
+			_ = os.Remove(bak)
+			if _, err := s.db.Exec(`VACUUM INTO ?`, bak); err != nil {
+				return migrationReport{}, sqliteErr(err)
+			}
+			defer func() { _ = os.Chmod(bak, 0o600) }()
+		}
+	}
+	var rep migrationReport
+	err = s.tx(func(tx *sql.Tx) error {
+		tweets, err := queryRaw(tx, `SELECT data FROM tweets`)
+		if err != nil {
+			return err
+		}
+		gens, err := queryRaw(tx, `SELECT data FROM generations`)
+		if err != nil {
+			return err
+		}
+		rep, err = applyMigrations(from, tweets, gens)
+		rep.DryRun = dry
+		if err != nil || dry || from == schemaVersion {
+			return err
+		}
+		for _, m := range tweets {
+			var t Tweet
+			if err := remarshal(m, &t); err != nil {
+				return err
+			}
+			if err := putTweet(tx, t); err != nil {
+				return err
+			}
+		}
+		for _, m := range gens {
+			raw, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`UPDATE generations SET data = ? WHERE id = ?`, string(raw), str(m["id"])); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES ('schema_version', ?)`, strconv.Itoa(schemaVersion))
+		return err
+	})
+	if err == nil && !dry && from < schemaVersion {
+		if bak := fmt.Sprintf("%s.v%d.bak", s.path, from); fileExists(bak) {
+			rep.Backups = append(rep.Backups, bak)
+		}
+	}
+	return rep, err
+}
+
+func remarshal(in, out any) error {
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (s *sqliteStore) tx(fn func(*sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return sqliteErr(err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return sqliteErr(err)
+	}
+	return sqliteErr(tx.Commit())
+}
+
+func (s *sqliteStore) Close() error { return s.db.Close() }
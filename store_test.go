@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteStoreCRUD(t *testing.T) {
+	withTempCwd(t, func() {
+		t.Setenv("XPOSTCTL_STORE", sqliteBackend)
+		tid := "thr1"
+		b, err := createTweet("second", &tid, 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, _ := createTweet("first", &tid, 0, nil)
+		solo, _ := createTweet("solo", nil, 0, nil)
+		thr, err := threadTweets(tid)
+		if err != nil || len(thr) != 2 || thr[0].ID != a.ID || thr[1].ID != b.ID {
+			t.Fatalf("thread=%+v err=%v", thr, err)
+		}
+		up, err := updateTweet(solo.ID, func(tw *Tweet) { tw.Status = failedStatus })
+		if err != nil || up == nil || up.Status != failedStatus {
+			t.Fatalf("update=%+v err=%v", up, err)
+		}
+		if missing, err := updateTweet("nope", func(*Tweet) {}); err != nil || missing != nil {
+			t.Fatalf("missing=%+v err=%v", missing, err)
+		}
+		failed, _ := listTweets(failedStatus)
+		if len(failed) != 1 || failed[0].ID != solo.ID {
+			t.Fatalf("failed=%+v", failed)
+		}
+		if err := deleteTweet(a.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := getTweet(a.ID); got != nil {
+			t.Fatalf("not deleted: %+v", got)
+		}
+		if _, err := saveGen(Gen{Prompt: "p", Output: "o", Model: "template"}); err != nil {
+			t.Fatal(err)
+		}
+		s, _ := openStore()
+		if gens, _ := s.ListGens(); len(gens) != 1 {
+			t.Fatalf("gens=%+v", gens)
+		}
+	})
+}
+
+func TestStoreMigrateToSQLite(t *testing.T) {
+	withTempCwd(t, func() {
+		a, _ := createTweet("one", nil, 0, nil)
+		_, _ = createTweet("two", nil, 0, nil)
+		_, _ = saveGen(Gen{Prompt: "p", Output: "o", Model: "template"})
+		res, err := storeCmd([]string{"migrate", "--to", "sqlite"}, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := res.(map[string]any); m["tweets"] != 2 || m["generations"] != 1 {
+			t.Fatalf("res=%+v", m)
+		}
+		if storeBackend() != sqliteBackend {
+			t.Fatalf("backend=%s", storeBackend())
+		}
+		s, _ := openStore()
+		if v, err := s.SchemaVersion(); err != nil || v != schemaVersion {
+			t.Fatalf("sqlite schema=%d err=%v", v, err)
+		}
+		got, err := getTweet(a.ID)
+		if err != nil || got == nil || got.Content != "one" {
+			t.Fatalf("got=%+v err=%v", got, err)
+		}
+		if _, err := storeCmd([]string{"migrate", "--to", "sqlite"}, Ctx{JSON: true}); err == nil {
+			t.Fatal("expected conflict")
+		}
+	})
+}
+
+func TestStoreMigrateRoundTripKeepsDeletes(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		keep, _ := createTweet("keep", nil, 0, nil)
+		gone, _ := createTweet("gone", nil, 0, nil)
+		if _, err := storeCmd([]string{"migrate", "--to", "sqlite"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := deleteTweet(gone.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storeCmd([]string{"migrate", "--to", "json"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("non-empty destination err=%v", err)
+		}
+		if _, err := storeCmd([]string{"migrate", "--to", "json", "--force"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if storeBackend() != jsonBackend {
+			t.Fatalf("backend=%s", storeBackend())
+		}
+		if got, _ := getTweet(gone.ID); got != nil {
+			t.Fatal("deleted tweet came back")
+		}
+		if got, _ := getTweet(keep.ID); got == nil {
+			t.Fatal("kept tweet lost")
+		}
+		if _, err := storeCmd([]string{"migrate", "--to", "sqlite", "--force"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if all, _ := listTweets(""); len(all) != 1 {
+			t.Fatalf("tweets=%+v", all)
+		}
+	})
+}
+
+func TestStoreMigrateRefusesPlaintextCredentials(t *testing.T) {
+	withTempCwd(t, func() {
+		if err := ensureData(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfgPath(), []byte(`{"twitter":{"apiKey":"plain"}}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storeCmd([]string{"migrate", "--to", "sqlite"}, Ctx{JSON: true}); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("err=%v", err)
+		}
+		if b, _ := os.ReadFile(cfgPath()); !strings.Contains(string(b), "plain") {
+			t.Fatalf("config rewritten: %s", b)
+		}
+	})
+}
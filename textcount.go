@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// X's weighted length rules (twitter-text v3 config): text is NFC-normalized,
+// code points in the ranges below weigh 1, everything else (CJK, most
+// symbols) weighs 2, an emoji sequence weighs 2 however many code points it
+// has, and every URL counts as a 23-character t.co link.
+const (
+	maxTweetLength    = 280
+	tcoURLLength      = 23
+	weightScale       = 100
+	defaultCharWeight = 200
+)
+
+var lightRanges = [][2]rune{{0, 4351}, {8192, 8205}, {8208, 8223}, {8242, 8247}}
+
+var urlRe = regexp.MustCompile(`(?i)(?:https?://[^\s<>"]+|(?:www\.)?(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+(?:com|org|net|io|dev|ai|co|app|me|gg|ly|so|sh|to|fm|tv|xyz|info|biz|edu|gov|us|uk|de|fr|jp|ca|au|news|blog|tech)\b(?:/[^\s<>"]*)?)`)
+
+// segment is the smallest piece of text that must never be split: a URL, an
+// emoji sequence or a single code point.
+type segment struct {
+	text   string
+	weight int
+	url    bool
+}
+
+func charWeight(r rune) int {
+	for _, rg := range lightRanges {
+		if r >= rg[0] && r <= rg[1] {
+			return weightScale
+		}
+	}
+	return defaultCharWeight
+}
+
+// findURLs returns the byte ranges of URLs, trimming trailing punctuation and
+// skipping bare domains that are really part of an email or handle.
+func findURLs(s string) [][2]int {
+	out := [][2]int{}
+	for _, m := range urlRe.FindAllStringIndex(s, -1) {
+		start, end := m[0], m[1]
+		for end > start && strings.ContainsRune(".,;:!?)'\"", rune(s[end-1])) {
+			end--
+		}
+		if !strings.Contains(strings.ToLower(s[start:end]), "://") && start > 0 {
+			if prev, _ := utf8.DecodeLastRuneInString(s[:start]); prev == '@' || prev == '.' || isWordRune(prev) {
+				continue
+			}
+		}
+		out = append(out, [2]int{start, end})
+	}
+	return out
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '-' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isPictographic(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2300 && r <= 0x23FF) || (r >= 0x2600 && r <= 0x27BF) ||
+		(r >= 0x2B00 && r <= 0x2BFF) || r == 0x00A9 || r == 0x00AE || r == 0x203C || r == 0x2049 ||
+		r == 0x2122 || r == 0x2139 || (r >= 0x2194 && r <= 0x21AA) || r == 0x3030 || r == 0x303D ||
+		r == 0x3297 || r == 0x3299
+}
+
+func isRegional(r rune) bool { return r >= 0x1F1E6 && r <= 0x1F1FF }
+
+func isEmojiModifier(r rune) bool {
+	return r == 0xFE0F || r == 0xFE0E || r == 0x20E3 || (r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F)
+}
+
+// emojiLen returns the byte length of the emoji sequence at the start of s,
+// or 0. BMP symbols only count as emoji in their emoji presentation (FE0F).
+func emojiLen(s string) int {
+	r, n := utf8.DecodeRuneInString(s)
+	next, nn := utf8.DecodeRuneInString(s[n:])
+	switch {
+	case isRegional(r):
+		if isRegional(next) {
+			return n + nn
+		}
+		return n
+	case (r >= '0' && r <= '9') || r == '#' || r == '*':
+		i := n
+		if next == 0xFE0F {
+			i += nn
+		}
+		if kc, kn := utf8.DecodeRuneInString(s[i:]); kc == 0x20E3 {
+			return i + kn
+		}
+		return 0
+	case !isPictographic(r):
+		return 0
+	case r < 0x10000 && next != 0xFE0F:
+		return 0
+	}
+	i := n
+	for i < len(s) {
+		c, cn := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case isEmojiModifier(c):
+			i += cn
+		case c == 0x200D:
+			if p, pn := utf8.DecodeRuneInString(s[i+cn:]); isPictographic(p) {
+				i += cn + pn
+				continue
+			}
+			return i
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// segments splits NFC-normalized text into weighted, unsplittable pieces.
+func segments(s string) []segment {
+	s = norm.NFC.String(s)
+	urls := findURLs(s)
+	out := []segment{}
+	for i, u := 0, 0; i < len(s); {
+		if u < len(urls) && urls[u][0] == i {
+			out = append(out, segment{text: s[urls[u][0]:urls[u][1]], weight: tcoURLLength * weightScale, url: true})
+			i = urls[u][1]
+			u++
+			continue
+		}
+		if n := emojiLen(s[i:]); n > 0 {
+			out = append(out, segment{text: s[i : i+n], weight: defaultCharWeight})
+			i += n
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		out = append(out, segment{text: s[i : i+n], weight: charWeight(r)})
+		i += n
+	}
+	return out
+}
+
+// weightedLength is the length X enforces against maxTweetLength.
+func weightedLength(s string) int {
+	total := 0
+	for _, sg := range segments(s) {
+		total += sg.weight
+	}
+	return total / weightScale
+}
+
+// truncateWeighted shortens s to at most limit weighted characters without
+// cutting through a code point, an emoji sequence or a URL.
+func truncateWeighted(s string, limit int) string {
+	var b strings.Builder
+	total := 0
+	for _, sg := range segments(s) {
+		if total+sg.weight > limit*weightScale {
+			break
+		}
+		total += sg.weight
+		b.WriteString(sg.text)
+	}
+	return b.String()
+}
+
+// lengthWarning describes why text is too long for one tweet, or "".
+func lengthWarning(text string) string {
+	if n := weightedLength(text); n > maxTweetLength {
+		return fmt.Sprintf("text is %d chars (max %d)", n, maxTweetLength)
+	}
+	return ""
+}
+
+type textCount struct {
+	Weighted  int  `json:"weighted"`
+	Max       int  `json:"max"`
+	Remaining int  `json:"remaining"`
+	Valid     bool `json:"valid"`
+	Runes     int  `json:"runes"`
+	URLs      int  `json:"urls"`
+}
+
+func countText(s string) textCount {
+	w, n := weightedLength(s), norm.NFC.String(s)
+	return textCount{Weighted: w, Max: maxTweetLength, Remaining: maxTweetLength - w, Valid: w > 0 && w <= maxTweetLength, Runes: utf8.RuneCountInString(n), URLs: len(findURLs(n))}
+}
+
+func countCmd(args []string, ctx Ctx) (any, error) {
+	text := strings.Join(args, " ")
+	if len(args) == 0 {
+		raw, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		text = strings.TrimRight(string(raw), "\r\n")
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet count <text> (or pipe text on stdin)", nil)
+	}
+	c := countText(text)
+	if !ctx.JSON {
+		fmt.Printf("  %d/%d (%d remaining)\n", c.Weighted, c.Max, c.Remaining)
+		if !c.Valid {
+			fmt.Println("  Too long for a single tweet")
+		}
+	}
+	return c, nil
+}
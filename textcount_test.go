@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWeightedLength(t *testing.T) {
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"hello", 5},
+		{"café", 4},
+		{"café", 4},
+		{"日本語", 6},
+		{"hi 👋", 5},
+		{"👍🏽", 2},
+		{"👨‍👩‍👧‍👦", 2},
+		{"🇩🇪", 2},
+		{"❤️", 2},
+		{"see https://example.com/a/very/long/path?with=query&and=more", 4 + tcoURLLength},
+		{"go to example.com.", 6 + tcoURLLength + 1},
+		{"mail me@example.com", 19},
+		{"“quoted” — ok…", 15},
+	}
+	for _, c := range cases {
+		if got := weightedLength(c.text); got != c.want {
+			t.Errorf("weightedLength(%q)=%d want %d", c.text, got, c.want)
+		}
+	}
+	if c := countText(strings.Repeat("字", 141)); c.Valid || c.Weighted != 282 || c.Remaining != -2 {
+		t.Fatalf("count=%+v", c)
+	}
+	if c := countText(strings.Repeat("a", 200) + " https://example.com/" + strings.Repeat("x", 200)); !c.Valid || c.URLs != 1 {
+		t.Fatalf("count=%+v", c)
+	}
+}
+
+func TestTruncateWeighted(t *testing.T) {
+	if got := truncateWeighted(strings.Repeat("字", 200), maxTweetLength); weightedLength(got) != 280 || !strings.HasSuffix(got, "字") {
+		t.Fatalf("len=%d", weightedLength(got))
+	}
+	s := strings.Repeat("a", 270) + " https://example.com/x"
+	if got := truncateWeighted(s, maxTweetLength); got != strings.Repeat("a", 270)+" " {
+		t.Fatalf("url was cut: %q", got[260:])
+	}
+	if got := truncateWeighted("ab👨‍👩‍👧", 3); got != "ab" {
+		t.Fatalf("emoji was cut: %q", got)
+	}
+}
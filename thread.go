@@ -0,0 +1,695 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	paragraphRe = regexp.MustCompile(`\n\s*\n`)
+	wordRe      = regexp.MustCompile(`\S+`)
+)
+
+// threadUnit is a piece of text a thread may be split after, with the
+// whitespace that separated it from the previous piece.
+type threadUnit struct {
+	text string
+	sep  string
+}
+
+// splitThread breaks text into tweets of at most limit weighted characters.
+// Paragraphs are kept whole when they fit, then sentences, then words; URLs
+// and mentions are words and are never cut. With number set every part gets
+// an " i/n" counter that is included in the limit.
+func splitThread(text string, limit int, number bool) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if weightedLength(text) <= limit {
+		return []string{text}
+	}
+	if !number {
+		return packUnits(threadUnits(text, limit), limit)
+	}
+	n := len(packUnits(threadUnits(text, limit), limit))
+	for {
+		room := limit - weightedLength(fmt.Sprintf(" %d/%d", n, n))
+		parts := packUnits(threadUnits(text, room), room)
+		if len(parts) <= n {
+			for i := range parts {
+				parts[i] = fmt.Sprintf("%s %d/%d", parts[i], i+1, len(parts))
+			}
+			return parts
+		}
+		n = len(parts)
+	}
+}
+
+func threadUnits(text string, limit int) []threadUnit {
+	out := []threadUnit{}
+	for i, para := range paragraphRe.Split(text, -1) {
+		sep := "\n\n"
+		if i == 0 {
+			sep = ""
+		}
+		para = strings.TrimSpace(para)
+		if weightedLength(para) <= limit {
+			out = append(out, threadUnit{para, sep})
+			continue
+		}
+		for j, sent := range sentences(para) {
+			if j == 0 {
+				sent[0].sep = sep
+			}
+			if s := joinUnits(sent); weightedLength(s) <= limit {
+				out = append(out, threadUnit{s, sent[0].sep})
+				continue
+			}
+			for _, w := range sent {
+				out = append(out, hardSplit(w, limit)...)
+			}
+		}
+	}
+	return out
+}
+
+// sentences groups the words of a paragraph into sentences.
+func sentences(para string) [][]threadUnit {
+	out := [][]threadUnit{}
+	cur := []threadUnit{}
+	prev := 0
+	for _, m := range wordRe.FindAllStringIndex(para, -1) {
+		sep := " "
+		if strings.Contains(para[prev:m[0]], "\n") {
+			sep = "\n"
+		}
+		if prev == 0 {
+			sep = ""
+		}
+		w := para[m[0]:m[1]]
+		cur = append(cur, threadUnit{w, sep})
+		prev = m[1]
+		if endsSentence(w) {
+			out = append(out, cur)
+			cur = []threadUnit{}
+		}
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+func endsSentence(w string) bool {
+	if len(findURLs(w)) > 0 {
+		return false
+	}
+	w = strings.TrimRight(w, `"')]”’`)
+	r, _ := utf8.DecodeLastRuneInString(w)
+	return strings.ContainsRune(".!?…", r)
+}
+
+func joinUnits(units []threadUnit) string {
+	var b strings.Builder
+	for i, u := range units {
+		if i > 0 {
+			b.WriteString(u.sep)
+		}
+		b.WriteString(u.text)
+	}
+	return b.String()
+}
+
+// hardSplit cuts a single word longer than limit; it is the only place a
+// split can fall inside a word, and only happens for words no tweet can hold.
+func hardSplit(u threadUnit, limit int) []threadUnit {
+	if weightedLength(u.text) <= limit {
+		return []threadUnit{u}
+	}
+	out := []threadUnit{}
+	rest := u.text
+	for rest != "" {
+		head := truncateWeighted(rest, limit)
+		if head == "" {
+			head = rest
+		}
+		out = append(out, threadUnit{head, u.sep})
+		rest = rest[len(head):]
+		u.sep = ""
+	}
+	return out
+}
+
+func packUnits(units []threadUnit, limit int) []string {
+	parts := []string{}
+	cur := ""
+	for _, u := range units {
+		if cur != "" && weightedLength(cur+u.sep+u.text) <= limit {
+			cur += u.sep + u.text
+			continue
+		}
+		if cur != "" {
+			parts = append(parts, cur)
+		}
+		cur = u.text
+	}
+	if cur != "" {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+const threadUsage = "Usage: tweet thread <new|add|move|remove|join|show|split> ..."
+
+func threadCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) == 0 {
+		return nil, cliFail("INVALID_ARGS", threadUsage, map[string]any{"examples": []string{"tweet thread new <text>", "tweet thread add <thread> <text> [--at n]", "tweet thread move <id> <pos>", "tweet thread remove <id>", "tweet thread join <id> <id>...", "tweet thread show <thread>", "tweet thread split <id> [--number]"}})
+	}
+	switch args[0] {
+	case "new":
+		return threadNewCmd(args[1:], ctx)
+	case "add":
+		return threadAddCmd(args[1:], ctx)
+	case "move":
+		return threadMoveCmd(args[1:], ctx)
+	case "remove":
+		return threadRemoveCmd(args[1:], ctx)
+	case "join":
+		return threadJoinCmd(args[1:], ctx)
+	case "show":
+		return threadShowCmd(args[1:], ctx)
+	case "split":
+		return threadSplitCmd(args[1:], ctx)
+	default:
+		return nil, cliFail("INVALID_ARGS", "Unknown thread subcommand: "+args[0], map[string]any{"available": []string{"new", "add", "move", "remove", "join", "show", "split"}})
+	}
+}
+
+// resolveThread accepts a thread id or the id of any member and returns the
+// thread id with its members in order.
+func resolveThread(ref string) (string, []Tweet, error) {
+	s, err := openStore()
+	if err != nil {
+		return "", nil, err
+	}
+	return resolveThreadIn(s, ref)
+}
+
+// resolveThreadIn is resolveThread reading from v, such as the view of a
+// locked mutateTweets.
+func resolveThreadIn(v tweetView, ref string) (string, []Tweet, error) {
+	members, err := v.ThreadTweets(ref)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(members) > 0 {
+		return ref, members, nil
+	}
+	t, err := v.GetTweet(ref)
+	if err != nil {
+		return "", nil, err
+	}
+	if t == nil {
+		return "", nil, cliFail("NOT_FOUND", "Thread not found: "+ref, nil)
+	}
+	if t.ThreadID == nil {
+		return "", nil, cliFail("INVALID_ARGS", "Tweet is not in a thread: "+ref, map[string]any{"hint": "tweet thread join " + ref + " <id>..."})
+	}
+	members, err = v.ThreadTweets(*t.ThreadID)
+	return *t.ThreadID, members, err
+}
+
+func memberIndex(members []Tweet, id string) int {
+	for i, m := range members {
+		if m.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// parsePos reads a 1-based position and clamps it to 1..max.
+func parsePos(s string, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, cliFail("INVALID_ARGS", "Invalid position: "+s+" (positions start at 1)", nil)
+	}
+	return min(n, max), nil
+}
+
+// guardPosted refuses edits that would move a posted member; members[from:to]
+// is the range whose positions change. A thread the worker is posting is
+// refused as a whole: it posts the members it claimed in order, and a reply
+// chain cannot be reshaped halfway through.
+func guardPosted(members []Tweet, from, to int) error {
+	for _, m := range members {
+		if m.Status == postingStatus {
+			return cliFail("CONFLICT", "Thread is being posted by the worker; tweet "+m.ID+" is in flight", map[string]any{"id": m.ID, "position": m.ThreadPos + 1})
+		}
+	}
+	for _, m := range members[from:to] {
+		if m.Status == postedStatus {
+			return cliFail("CONFLICT", "Thread edit would move posted tweet "+m.ID, map[string]any{"id": m.ID, "position": m.ThreadPos + 1})
+		}
+	}
+	return nil
+}
+
+// renumber makes positions contiguous and returns the members whose
+// position changed.
+func renumber(members []Tweet) []Tweet {
+	out := []Tweet{}
+	for i := range members {
+		if members[i].ThreadPos != i {
+			members[i].ThreadPos = i
+			out = append(out, members[i])
+		}
+	}
+	return out
+}
+
+// joinSchedule gives t the thread's schedule, since the worker posts a
+// scheduled thread as a whole.
+func joinSchedule(t *Tweet, members []Tweet) {
+	for _, m := range members {
+		if m.Status == scheduledStatus {
+			t.Status = scheduledStatus
+			t.ScheduledAt = m.ScheduledAt
+			return
+		}
+	}
+}
+
+func putTweets(items ...Tweet) error {
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	return s.PutTweets(items...)
+}
+
+// mutateTweets reads, checks and writes tweets as one locked store
+// operation. Thread edits go through it so a member the worker posts in the
+// meantime is never overwritten with a stale draft copy, and the worker
+// claims due tweets through it.
+func mutateTweets(fn func(tweetView) ([]Tweet, error)) error {
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	return s.MutateTweets(fn)
+}
+
+func printThread(tid string, members []Tweet) {
+	fmt.Printf("\n  Thread %s (%d tweets)\n", tid, len(members))
+	for _, m := range members {
+		fmt.Printf("  [%d] %s  %-9s %3d  %s\n", m.ThreadPos+1, m.ID, m.Status, weightedLength(m.Content), m.Content)
+	}
+	fmt.Println()
+}
+
+func threadResult(action, tid string) (any, error) {
+	members, err := threadTweets(tid)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"action": action, "threadId": tid, "count": len(members), "tweets": members}, nil
+}
+
+func threadNewCmd(args []string, ctx Ctx) (any, error) {
+	args, specs, err := splitMediaArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(strings.Join(args, " "))
+	if text == "" {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet thread new <text> [--media <path> [--alt <text>]]...", nil)
+	}
+	media, err := loadMedia(specs)
+	if err != nil {
+		return nil, err
+	}
+	tid := newID(12)
+	tw := newTweet(text, &tid, 0, nil)
+	tw.Media = media
+	if _, err := insertTweet(tw); err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Created thread %s with %s\n", tid, tw.ID)
+	}
+	return threadResult("created", tid)
+}
+
+func threadAddCmd(args []string, ctx Ctx) (any, error) {
+	args, specs, err := splitMediaArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	at := ""
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--at" && i+1 < len(args):
+			at = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--at="):
+			at = strings.TrimPrefix(args[i], "--at=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	if len(rest) < 2 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet thread add <thread> <text> [--at n] [--media <path> [--alt <text>]]...", nil)
+	}
+	text := strings.TrimSpace(strings.Join(rest[1:], " "))
+	media, err := loadMedia(specs)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		tid string
+		tw  Tweet
+		pos int
+	)
+	err = mutateTweets(func(v tweetView) ([]Tweet, error) {
+		var members []Tweet
+		var err error
+		if tid, members, err = resolveThreadIn(v, rest[0]); err != nil {
+			return nil, err
+		}
+		pos = len(members) + 1
+		if at != "" {
+			if pos, err = parsePos(at, len(members)+1); err != nil {
+				return nil, err
+			}
+		}
+		if err := guardPosted(members, pos-1, len(members)); err != nil {
+			return nil, err
+		}
+		th := tid
+		tw = newTweet(text, &th, pos-1, members[0].Tags)
+		tw.Media = media
+		joinSchedule(&tw, members)
+		members = append(members[:pos-1], append([]Tweet{tw}, members[pos-1:]...)...)
+		return append(renumber(members), tw), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Added %s at position %d\n", tw.ID, pos)
+		if w := lengthWarning(text); w != "" {
+			fmt.Println("  Warning:", w)
+		}
+	}
+	return threadResult("added", tid)
+}
+
+func threadMoveCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) < 2 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet thread move <id> <pos>", nil)
+	}
+	var (
+		tid   string
+		moved Tweet
+		pos   int
+	)
+	err := mutateTweets(func(v tweetView) ([]Tweet, error) {
+		var members []Tweet
+		var err error
+		if tid, members, err = resolveThreadIn(v, args[0]); err != nil {
+			return nil, err
+		}
+		from := memberIndex(members, args[0])
+		if from < 0 {
+			return nil, cliFail("INVALID_ARGS", "thread move takes a tweet id, not a thread id", nil)
+		}
+		if pos, err = parsePos(args[1], len(members)); err != nil {
+			return nil, err
+		}
+		to := pos - 1
+		if err := guardPosted(members, min(from, to), max(from, to)+1); err != nil {
+			return nil, err
+		}
+		moved = members[from]
+		members = append(members[:from], members[from+1:]...)
+		members = append(members[:to], append([]Tweet{moved}, members[to:]...)...)
+		return renumber(members), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Moved %s to position %d\n", moved.ID, pos)
+	}
+	return threadResult("moved", tid)
+}
+
+// threadRemoveCmd detaches a tweet from its thread; it stays as a standalone
+// draft (use draft --delete to drop it entirely).
+func threadRemoveCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) < 1 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet thread remove <id>", nil)
+	}
+	var (
+		tid  string
+		gone Tweet
+	)
+	err := mutateTweets(func(v tweetView) ([]Tweet, error) {
+		var members []Tweet
+		var err error
+		if tid, members, err = resolveThreadIn(v, args[0]); err != nil {
+			return nil, err
+		}
+		i := memberIndex(members, args[0])
+		if i < 0 {
+			return nil, cliFail("INVALID_ARGS", "thread remove takes a tweet id, not a thread id", nil)
+		}
+		if err := guardPosted(members, i, len(members)); err != nil {
+			return nil, err
+		}
+		gone = members[i]
+		gone.ThreadID = nil
+		gone.ThreadPos = 0
+		if gone.Status == scheduledStatus {
+			gone.Status = draftStatus
+			gone.ScheduledAt = nil
+		}
+		members = append(members[:i], members[i+1:]...)
+		return append(renumber(members), gone), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Removed %s from thread %s (kept as a draft)\n", gone.ID, tid)
+	}
+	return threadResult("removed", tid)
+}
+
+// threadJoinCmd appends standalone drafts, in the order given, to the thread
+// named by the first argument (a thread id or member id), or to a new thread
+// when the first id is a standalone draft too.
+func threadJoinCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) < 2 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet thread join <id> <id>...", nil)
+	}
+	tid := newID(12)
+	var members []Tweet
+	err := mutateTweets(func(v tweetView) ([]Tweet, error) {
+		var err error
+		if members, err = v.ThreadTweets(args[0]); err != nil {
+			return nil, err
+		}
+		if len(members) > 0 {
+			tid = args[0]
+		} else {
+			head, err := v.GetTweet(args[0])
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case head == nil:
+				return nil, cliFail("NOT_FOUND", "Tweet not found: "+args[0], nil)
+			case head.ThreadID != nil:
+				if tid, members, err = resolveThreadIn(v, head.ID); err != nil {
+					return nil, err
+				}
+			case head.Status != draftStatus:
+				return nil, cliFail("CONFLICT", "Can only join drafts (current status of "+head.ID+": "+head.Status+")", map[string]any{"id": head.ID})
+			default:
+				members = append(members, *head)
+			}
+		}
+		seen := map[string]bool{args[0]: true}
+		for _, id := range args[1:] {
+			if seen[id] {
+				return nil, cliFail("INVALID_ARGS", "Duplicate id: "+id, nil)
+			}
+			seen[id] = true
+			t, err := v.GetTweet(id)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, cliFail("NOT_FOUND", "Tweet not found: "+id, nil)
+			}
+			if t.ThreadID != nil {
+				return nil, cliFail("CONFLICT", "Already in thread "+*t.ThreadID+": "+id, map[string]any{"id": id, "hint": "tweet thread remove " + id})
+			}
+			if t.Status != draftStatus {
+				return nil, cliFail("CONFLICT", "Can only join drafts (current status of "+id+": "+t.Status+")", map[string]any{"id": id})
+			}
+			joinSchedule(t, members)
+			members = append(members, *t)
+		}
+		for i := range members {
+			th := tid
+			members[i].ThreadID = &th
+		}
+		renumber(members)
+		return members, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Joined %d tweets into thread %s\n", len(members), tid)
+	}
+	return threadResult("joined", tid)
+}
+
+func threadShowCmd(args []string, ctx Ctx) (any, error) {
+	if len(args) < 1 {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet thread show <thread>", nil)
+	}
+	tid, members, err := resolveThread(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		printThread(tid, members)
+	}
+	return map[string]any{"threadId": tid, "count": len(members), "tweets": members}, nil
+}
+
+// threadSplitCmd turns an over-long draft into a thread. The draft keeps its
+// id, media and position and holds the first part; the rest are inserted
+// after it.
+func threadSplitCmd(args []string, ctx Ctx) (any, error) {
+	id := ""
+	for _, a := range args {
+		if !strings.HasPrefix(a, "--") {
+			id = a
+		}
+	}
+	if id == "" {
+		return nil, cliFail("INVALID_ARGS", "Usage: tweet thread split <id> [--number]", nil)
+	}
+	number := hasFlag(args, "--number")
+	var (
+		t   *Tweet
+		tid string
+		out []Tweet
+	)
+	err := mutateTweets(func(v tweetView) ([]Tweet, error) {
+		var err error
+		if t, err = v.GetTweet(id); err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return nil, cliFail("NOT_FOUND", "Tweet not found: "+id, nil)
+		}
+		if t.Status != draftStatus {
+			return nil, cliFail("CONFLICT", "Can only split drafts (current status: "+t.Status+")", nil)
+		}
+		if number && t.ThreadID != nil {
+			return nil, cliFail("INVALID_ARGS", "--number only applies to standalone drafts; this one is already in thread "+*t.ThreadID, nil)
+		}
+		parts := splitThread(t.Content, maxTweetLength, number)
+		if len(parts) < 2 {
+			return nil, nil
+		}
+		tid = newID(12)
+		after := []Tweet{}
+		if t.ThreadID != nil {
+			tid = *t.ThreadID
+			members, err := v.ThreadTweets(tid)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range members {
+				if m.ThreadPos > t.ThreadPos {
+					m.ThreadPos += len(parts) - 1
+					after = append(after, m)
+				}
+			}
+			if err := guardPosted(after, 0, len(after)); err != nil {
+				return nil, err
+			}
+		}
+		head := *t
+		head.Content = parts[0]
+		head.ThreadID = &tid
+		out = []Tweet{head}
+		for i, p := range parts[1:] {
+			th := tid
+			out = append(out, newTweet(p, &th, head.ThreadPos+i+1, t.Tags))
+		}
+		return append(append([]Tweet{}, out...), after...), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		if !ctx.JSON {
+			fmt.Println("  Already fits in one tweet:", id)
+		}
+		return map[string]any{"action": "unchanged", "tweets": []Tweet{*t}}, nil
+	}
+	if !ctx.JSON {
+		fmt.Printf("  Split %s into %d tweets (thread %s)\n", id, len(out), tid)
+		for _, tw := range out {
+			fmt.Printf("  [%d] %s\n", tw.ThreadPos+1, tw.Content)
+		}
+	}
+	return map[string]any{"action": "split", "threadId": tid, "count": len(out), "tweets": out}, nil
+}
+
+// draftThreadCmd is draft --thread: it splits text into a new thread of
+// drafts; media goes on the first tweet.
+func draftThreadCmd(text string, number bool, media []Media, ctx Ctx) (any, error) {
+	parts := splitThread(text, maxTweetLength, number)
+	var tid *string
+	if len(parts) > 1 {
+		id := newID(12)
+		tid = &id
+	}
+	out := make([]Tweet, 0, len(parts))
+	for i, p := range parts {
+		tw := newTweet(p, tid, i, nil)
+		if i == 0 {
+			tw.Media = media
+		}
+		out = append(out, tw)
+	}
+	if err := putTweets(out...); err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		if tid != nil {
+			fmt.Printf("  Created thread %s (%d drafts)\n", *tid, len(out))
+		} else {
+			fmt.Println("  Created draft", out[0].ID)
+		}
+		for _, tw := range out {
+			fmt.Printf("  [%d] %s\n", tw.ThreadPos+1, tw.Content)
+		}
+	}
+	return map[string]any{"action": "created", "threadId": tid, "count": len(out), "tweets": out}, nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// stubX answers X API requests with handle instead of the network.
+func stubX(t *testing.T, handle func(body map[string]any) (int, string)) {
+	prevDelay := threadPostDelay
+	threadPostDelay = 0
+	t.Cleanup(func() { threadPostDelay = prevDelay })
+	stubXRoundTrip(t, func(r *http.Request) (int, http.Header, string) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		code, out := handle(body)
+		return code, http.Header{}, out
+	})
+}
+
+func stubXResponses(t *testing.T, handle func() (int, http.Header, string)) {
+	stubXRoundTrip(t, func(*http.Request) (int, http.Header, string) { return handle() })
+}
+
+func stubXRoundTrip(t *testing.T, handle func(*http.Request) (int, http.Header, string)) {
+	prev := xHTTPClient
+	xHTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		// publish looks up the posting account first; answer it here so
+		// handle only sees the calls a test is about.
+		code, h, out := http.StatusOK, http.Header{}, `{"data":{"id":"1","name":"Stub","username":"stub"}}`
+		if r.URL.Path != "/2/users/me" {
+			code, h, out = handle(r)
+		}
+		return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(out)), Header: h, Request: r}, nil
+	})}
+	t.Cleanup(func() { xHTTPClient = prev })
+}
+
+func TestSplitThread(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&b, "Sentence %d mentions @someone_%d and links https://example.com/post/%d for details. ", i, i, i)
+		if i%10 == 9 {
+			b.WriteString("\n\n")
+		}
+	}
+	text := b.String()
+	for _, number := range []bool{false, true} {
+		parts := splitThread(text, maxTweetLength, number)
+		if len(parts) < 2 {
+			t.Fatalf("parts=%d", len(parts))
+		}
+		words := strings.Fields(text)
+		got := []string{}
+		for i, p := range parts {
+			if n := weightedLength(p); n > maxTweetLength {
+				t.Fatalf("part %d is %d chars", i, n)
+			}
+			if number {
+				suffix := fmt.Sprintf(" %d/%d", i+1, len(parts))
+				if !strings.HasSuffix(p, suffix) {
+					t.Fatalf("part %d missing counter: %q", i, p)
+				}
+				p = strings.TrimSuffix(p, suffix)
+			}
+			if !strings.HasSuffix(p, ".") {
+				t.Fatalf("part %d does not end on a sentence: %q", i, p)
+			}
+			got = append(got, strings.Fields(p)...)
+		}
+		if strings.Join(got, " ") != strings.Join(words, " ") {
+			t.Fatal("words were cut, lost or reordered")
+		}
+	}
+
+	url := "https://example.com/" + strings.Repeat("x", 300)
+	parts := splitThread(strings.Repeat("word ", 100)+url, maxTweetLength, false)
+	if last := parts[len(parts)-1]; !strings.HasSuffix(last, " "+url) && last != url {
+		t.Fatalf("url was split: %q", last)
+	}
+	if got := splitThread("short", maxTweetLength, true); len(got) != 1 || got[0] != "short" {
+		t.Fatalf("got=%v", got)
+	}
+}
+
+func TestThreadSplitCmd(t *testing.T) {
+	withTempCwd(t, func() {
+		text := strings.Repeat("This is one sentence that goes on a while. ", 15)
+		tw, err := createTweet(text, nil, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := threadCmd([]string{"split", tw.ID, "--number"}, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := res.(map[string]any)["tweets"].([]Tweet)
+		if len(out) < 3 || out[0].ID != tw.ID {
+			t.Fatalf("out=%+v", out)
+		}
+		members, err := threadTweets(*out[0].ThreadID)
+		if err != nil || len(members) != len(out) {
+			t.Fatalf("members=%d err=%v", len(members), err)
+		}
+		for i, m := range members {
+			if m.ThreadPos != i || !strings.HasSuffix(m.Content, fmt.Sprintf("%d/%d", i+1, len(members))) {
+				t.Fatalf("member %d: pos=%d %q", i, m.ThreadPos, m.Content)
+			}
+		}
+		if _, err := threadCmd([]string{"split", members[1].ID, "--number"}, Ctx{JSON: true}); err == nil {
+			t.Fatal("expected --number to be refused inside a thread")
+		}
+		_, _ = updateTweet(members[0].ID, func(tt *Tweet) { tt.Content = text })
+		_, _ = updateTweet(members[1].ID, func(tt *Tweet) { tt.Status = postedStatus })
+		if _, err := threadCmd([]string{"split", members[0].ID}, Ctx{JSON: true}); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("split before posted member: err=%v", err)
+		}
+		if got, _ := getTweet(members[1].ID); got.Status != postedStatus || got.ThreadPos != 1 {
+			t.Fatalf("posted member changed: %+v", got)
+		}
+
+		res, err = draftCmd([]string{"--thread", text}, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := res.(map[string]any)["count"].(int); n < 2 {
+			t.Fatalf("count=%d", n)
+		}
+	})
+}
+
+func TestThreadEditing(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		contents := func(tid string) string {
+			members, err := threadTweets(tid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := []string{}
+			for i, m := range members {
+				if m.ThreadPos != i {
+					t.Fatalf("positions not contiguous: %+v", members)
+				}
+				out = append(out, m.Content)
+			}
+			return strings.Join(out, ",")
+		}
+		res, err := threadCmd([]string{"new", "a"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tid := res.(map[string]any)["threadId"].(string)
+		for _, args := range [][]string{{"add", tid, "c"}, {"add", tid, "b", "--at", "2"}, {"add", tid, "z", "--at", "1"}} {
+			if _, err := threadCmd(args, ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := contents(tid); got != "z,a,b,c" {
+			t.Fatalf("after add: %s", got)
+		}
+		members, _ := threadTweets(tid)
+		if _, err := threadCmd([]string{"move", members[0].ID, "9"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(tid); got != "a,b,c,z" {
+			t.Fatalf("after move: %s", got)
+		}
+		if _, err := threadCmd([]string{"remove", members[0].ID}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(tid); got != "a,b,c" {
+			t.Fatalf("after remove: %s", got)
+		}
+		d1, _ := createTweet("d", nil, 0, nil)
+		if _, err := threadCmd([]string{"join", tid, d1.ID, members[0].ID}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(tid); got != "a,b,c,d,z" {
+			t.Fatalf("after join: %s", got)
+		}
+
+		members, _ = threadTweets(tid)
+		_, _ = updateTweet(members[0].ID, func(tt *Tweet) { tt.Status = postedStatus })
+		if _, err := threadCmd([]string{"move", members[2].ID, "1"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("move over posted: err=%v", err)
+		}
+		if _, err := threadCmd([]string{"add", tid, "y", "--at", "1"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("insert before posted: err=%v", err)
+		}
+		if _, err := threadCmd([]string{"move", members[4].ID, "2"}, ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(tid); got != "a,z,b,c,d" {
+			t.Fatalf("after second move: %s", got)
+		}
+
+		members, _ = threadTweets(tid)
+		_, _ = updateTweet(members[1].ID, func(tt *Tweet) { tt.Status = postingStatus })
+		for _, args := range [][]string{{"add", tid, "y"}, {"move", members[4].ID, "3"}, {"remove", members[3].ID}} {
+			if _, err := threadCmd(args, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+				t.Fatalf("%v while posting: err=%v", args, err)
+			}
+		}
+		if got := contents(tid); got != "a,z,b,c,d" {
+			t.Fatalf("edited while posting: %s", got)
+		}
+	})
+}
+
+// TestThreadEditsKeepConcurrentPosts joins drafts into a thread while its
+// first member is being posted; the join must never write back a stale copy.
+func TestThreadEditsKeepConcurrentPosts(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend, func(t *testing.T) {
+			withTempCwd(t, func() {
+				t.Setenv("XPOSTCTL_STORE", backend)
+				res, err := threadCmd([]string{"new", "head"}, Ctx{JSON: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				tid := res.(map[string]any)["threadId"].(string)
+				members, _ := threadTweets(tid)
+				head := members[0].ID
+				var wg sync.WaitGroup
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					tweetID := "x-1"
+					_, _ = updateTweet(head, func(tt *Tweet) { tt.Status, tt.TweetID = postedStatus, &tweetID })
+				}()
+				for i := 0; i < 5; i++ {
+					d, _ := createTweet(fmt.Sprintf("part %d", i), nil, 0, nil)
+					if _, err := threadCmd([]string{"join", tid, d.ID}, Ctx{JSON: true}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				wg.Wait()
+				got, _ := getTweet(head)
+				if got.Status != postedStatus || got.TweetID == nil {
+					t.Fatalf("posted head overwritten: %+v", got)
+				}
+				if members, _ := threadTweets(tid); len(members) != 6 {
+					t.Fatalf("members=%d", len(members))
+				}
+			})
+		})
+	}
+}
+
+func TestMutateTweetsWritesNothingOnError(t *testing.T) {
+	withTempCwd(t, func() {
+		tw, _ := createTweet("keep", nil, 0, nil)
+		err := mutateTweets(func(v tweetView) ([]Tweet, error) {
+			cur, _ := v.GetTweet(tw.ID)
+			cur.Content = "changed"
+			return []Tweet{*cur}, cliFail("CONFLICT", "no", nil)
+		})
+		if err == nil {
+			t.Fatal("want error")
+		}
+		if got, _ := getTweet(tw.ID); got.Content != "keep" {
+			t.Fatalf("content=%q", got.Content)
+		}
+	})
+}
+
+func TestThreadPostResumesAfterFailure(t *testing.T) {
+	withTempCwd(t, func() {
+		tid := "thr1"
+		for i, text := range []string{"one", "two", "three"} {
+			if _, err := createTweet(text, &tid, i, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		members, _ := threadTweets(tid)
+		fail := "two"
+		replies := map[string]string{}
+		stubX(t, func(body map[string]any) (int, string) {
+			text := body["text"].(string)
+			if text == fail {
+				return 503, `{"title":"Service Unavailable"}`
+			}
+			if r, ok := body["reply"].(map[string]any); ok {
+				replies[text] = r["in_reply_to_tweet_id"].(string)
+			}
+			return 201, `{"data":{"id":"x-` + text + `","text":"` + text + `"}}`
+		})
+		c := twClient{quiet: true}
+		_, err := publish(c, &members[0], postOpts{}, Ctx{JSON: true})
+		if ce, ok := err.(*CliErr); !ok || ce.Code != "POST_FAILED" {
+			t.Fatalf("err=%v", err)
+		}
+		members, _ = threadTweets(tid)
+		if members[0].Status != postedStatus || members[1].Status != failedStatus || members[2].Status != draftStatus || !strings.Contains(members[1].Error, "503") {
+			t.Fatalf("after failure: %+v", members)
+		}
+
+		fail = ""
+		if _, err := publish(c, &members[0], postOpts{}, Ctx{JSON: true}); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("expected CONFLICT without --resume, got %v", err)
+		}
+		if _, err := publish(c, &members[0], postOpts{Resume: true}, Ctx{JSON: true}); err != nil {
+			t.Fatal(err)
+		}
+		members, _ = threadTweets(tid)
+		for _, m := range members {
+			if m.Status != postedStatus || m.Error != "" {
+				t.Fatalf("not posted: %+v", m)
+			}
+		}
+		if a := members[1].Attempts; len(a) != 2 || a[0].OK || a[0].HTTPStatus != 503 || a[0].Title != "Service Unavailable" || !a[1].OK {
+			t.Fatalf("attempts=%+v", a)
+		}
+		if replies["two"] != "x-one" || replies["three"] != "x-two" || len(replies) != 2 {
+			t.Fatalf("replies=%v", replies)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultWorkerInterval = 30 * time.Second
+
+type workerNext struct {
+	ID          string  `json:"id"`
+	ThreadID    *string `json:"thread_id"`
+	ScheduledAt string  `json:"scheduled_at"`
+	Content     string  `json:"content"`
+}
+
+type workerState struct {
+	PID         int         `json:"pid"`
+	StartedAt   string      `json:"started_at"`
+	HeartbeatAt string      `json:"heartbeat_at"`
+	StoppedAt   *string     `json:"stopped_at"`
+	Interval    string      `json:"interval"`
+	DryRun      bool        `json:"dry_run"`
+	Posted      int         `json:"posted"`
+	Failed      int         `json:"failed"`
+	LastError   *string     `json:"last_error"`
+	Next        *workerNext `json:"next"`
+}
+
+func workerPath() string { return filepath.Join(dataDir(), "worker.json") }
+
+// dueTweets returns scheduled tweets whose time has come, oldest first, with
+// each thread collapsed to its first member since publish posts the rest.
+func dueTweets(now time.Time) ([]Tweet, error) {
+	all, err := listTweets(scheduledStatus)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if a, b := deref(all[i].ScheduledAt), deref(all[j].ScheduledAt); a != b {
+			return a < b
+		}
+		return all[i].ThreadPos < all[j].ThreadPos
+	})
+	seen := map[string]bool{}
+	out := []Tweet{}
+	for _, t := range all {
+		at, err := time.Parse(time.RFC3339, deref(t.ScheduledAt))
+		if err != nil || at.After(now) {
+			continue
+		}
+		if t.ThreadID != nil {
+			if seen[*t.ThreadID] {
+				continue
+			}
+			seen[*t.ThreadID] = true
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// nextScheduled is the earliest scheduled tweet, due or not.
+func nextScheduled() (*workerNext, error) {
+	all, err := listTweets(scheduledStatus)
+	if err != nil {
+		return nil, err
+	}
+	var best *Tweet
+	for i := range all {
+		t := &all[i]
+		if best == nil || deref(t.ScheduledAt) < deref(best.ScheduledAt) || (deref(t.ScheduledAt) == deref(best.ScheduledAt) && t.ThreadPos < best.ThreadPos) {
+			best = t
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return &workerNext{ID: best.ID, ThreadID: best.ThreadID, ScheduledAt: deref(best.ScheduledAt), Content: best.Content}, nil
+}
+
+func workerCmd(args []string, ctx Ctx) (any, error) {
+	interval := defaultWorkerInterval
+	dry, once := false, false
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--dry":
+			dry = true
+		case a == "--once":
+			once = true
+		case a == "--interval" || strings.HasPrefix(a, "--interval="):
+			v := strings.TrimPrefix(a, "--interval=")
+			if a == "--interval" {
+				if i+1 >= len(args) {
+					return nil, cliFail("INVALID_ARGS", "Usage: tweet worker [--interval 30s] [--once] [--dry]", nil)
+				}
+				i++
+				v = args[i]
+			}
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Second {
+				return nil, cliFail("INVALID_ARGS", "Invalid --interval (min 1s): "+v, nil)
+			}
+			interval = d
+		}
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	release, err := holdLock(workerLockPath())
+	if err != nil {
+		if ce, ok := err.(*CliErr); ok && ce.Code == "LOCKED" {
+			return nil, cliFail("WORKER_RUNNING", "A worker is already running for profile "+currentProfile(), ce.Details)
+		}
+		return nil, err
+	}
+	defer release()
+	c := newClient(cfg, dry, ctx.JSON)
+	sig, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	now := time.Now().UTC().Format(time.RFC3339)
+	st := workerState{PID: os.Getpid(), StartedAt: now, Interval: interval.String(), DryRun: dry}
+	if !ctx.JSON {
+		fmt.Printf("  Worker started (pid %d, every %s)\n", st.PID, interval)
+	}
+loop:
+	for {
+		workerTick(c, &st, ctx)
+		if once {
+			break
+		}
+		select {
+		case <-sig.Done():
+			break loop
+		case <-time.After(interval):
+		}
+	}
+	ts := time.Now().UTC().Format(time.RFC3339)
+	st.StoppedAt = &ts
+	_ = writeJSON(workerPath(), st)
+	if !ctx.JSON {
+		fmt.Printf("  Worker stopped (posted %d, failed %d)\n", st.Posted, st.Failed)
+	}
+	return st, nil
+}
+
+// workerTick posts everything that is due and refreshes the heartbeat file.
+// Failures are recorded on the tweet and in the state, never fatal.
+func workerTick(c twClient, st *workerState, ctx Ctx) {
+	due, err := dueTweets(time.Now())
+	if err != nil {
+		msg := err.Error()
+		st.LastError = &msg
+	}
+	for i := range due {
+		t := &due[i]
+		claimed, err := claimDue(t)
+		if err != nil {
+			msg := t.ID + ": " + err.Error()
+			st.LastError = &msg
+			st.Failed++
+			if !ctx.JSON {
+				fmt.Println("  Skipped:", msg)
+			}
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if !ctx.JSON {
+			fmt.Printf("  [%s] posting %s\n", time.Now().Format("15:04:05"), t.ID)
+		}
+		if _, err := publish(c, t, postOpts{Resume: true}, Ctx{JSON: true}); err != nil {
+			msg := t.ID + ": " + err.Error()
+			st.LastError = &msg
+			st.Failed++
+			releaseClaim(t, err)
+			if !ctx.JSON {
+				fmt.Println("  Failed:", msg)
+			}
+			continue
+		}
+		st.Posted++
+	}
+	st.Next, _ = nextScheduled()
+	st.HeartbeatAt = time.Now().UTC().Format(time.RFC3339)
+	_ = writeJSON(workerPath(), st)
+}
+
+// inFlight refuses tweets that a running worker has claimed. Once no worker
+// holds worker.lock, a tweet a crash left in posting can be posted or
+// scheduled again, after checking the timeline.
+func inFlight(members []Tweet) error {
+	if !lockHeld(workerLockPath()) {
+		return nil
+	}
+	for _, m := range members {
+		if m.Status == postingStatus {
+			return cliFail("CONFLICT", "Being posted by the worker: "+m.ID, map[string]any{"id": m.ID})
+		}
+	}
+	return nil
+}
+
+// claimMembers are the tweets publish posts for t: its whole thread, or t.
+func claimMembers(v tweetView, t *Tweet) ([]Tweet, error) {
+	if t.ThreadID != nil {
+		return v.ThreadTweets(*t.ThreadID)
+	}
+	cur, err := v.GetTweet(t.ID)
+	if err != nil || cur == nil {
+		return nil, err
+	}
+	return []Tweet{*cur}, nil
+}
+
+// claimDue moves a due tweet, or the scheduled rest of its thread, from
+// scheduled to posting in one locked store operation. It reports false when
+// the tweet is no longer scheduled: cancelled, edited or already taken. A
+// flagged draft that schedule --force did not accept is not claimed but
+// failed, with a FLAGGED error.
+func claimDue(t *Tweet) (bool, error) {
+	claimed := false
+	var flagged error
+	err := mutateTweets(func(v tweetView) ([]Tweet, error) {
+		cur, err := v.GetTweet(t.ID)
+		if err != nil || cur == nil || cur.Status != scheduledStatus {
+			return nil, err
+		}
+		members, err := claimMembers(v, t)
+		if err != nil {
+			return nil, err
+		}
+		var unaccepted []Tweet
+		for _, m := range members {
+			if !m.FlagsAccepted {
+				unaccepted = append(unaccepted, m)
+			}
+		}
+		to := postingStatus
+		if flagged = flaggedIn(unaccepted, "schedule"); flagged != nil {
+			to = failedStatus
+		}
+		var out []Tweet
+		for _, m := range members {
+			if m.Status == scheduledStatus {
+				m.Status = to
+				if flagged != nil {
+					m.Error = flagged.Error()
+				}
+				out = append(out, m)
+			}
+		}
+		claimed = flagged == nil
+		return out, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, flagged
+}
+
+// releaseClaim marks what is still posting after a failed publish as failed,
+// so the worker does not pick it up again on every tick.
+func releaseClaim(t *Tweet, cause error) {
+	_ = mutateTweets(func(v tweetView) ([]Tweet, error) {
+		members, err := claimMembers(v, t)
+		if err != nil {
+			return nil, err
+		}
+		var out []Tweet
+		for _, m := range members {
+			if m.Status == postingStatus {
+				m.Status = failedStatus
+				if m.Error == "" {
+					m.Error = cause.Error()
+				}
+				out = append(out, m)
+			}
+		}
+		return out, nil
+	})
+}
+
+func statusCmd(args []string, ctx Ctx) (any, error) {
+	if err := ensureData(); err != nil {
+		return nil, err
+	}
+	st, err := readJSON[*workerState](workerPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	alive := false
+	if st != nil && st.StoppedAt == nil {
+		iv, _ := time.ParseDuration(st.Interval)
+		hb, err := time.Parse(time.RFC3339, st.HeartbeatAt)
+		alive = err == nil && time.Since(hb) <= 2*iv+10*time.Second
+	}
+	next, err := nextScheduled()
+	if err != nil {
+		return nil, err
+	}
+	due, err := dueTweets(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.JSON {
+		fmt.Println()
+		switch {
+		case st == nil:
+			fmt.Println("  worker: never started")
+		case alive:
+			fmt.Printf("  worker: alive (pid %d, heartbeat %s)\n", st.PID, st.HeartbeatAt)
+		case st.StoppedAt != nil:
+			fmt.Printf("  worker: stopped at %s\n", *st.StoppedAt)
+		default:
+			fmt.Printf("  worker: not responding (last heartbeat %s)\n", st.HeartbeatAt)
+		}
+		if next != nil {
+			fmt.Printf("  next: %s at %s\n", next.ID, next.ScheduledAt)
+		} else {
+			fmt.Println("  next: nothing scheduled")
+		}
+		if len(due) > 0 {
+			fmt.Printf("  due now: %d\n", len(due))
+		}
+		fmt.Println()
+	}
+	return map[string]any{"workerAlive": alive, "worker": st, "next": next, "due": len(due)}, nil
+}
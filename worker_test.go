@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerTickPostsDueTweets(t *testing.T) {
+	withTempCwd(t, func() {
+		past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		tid := "thr1"
+		a, _ := createTweet("head", &tid, 0, nil)
+		b, _ := createTweet("reply", &tid, 1, nil)
+		later, _ := createTweet("later", nil, 0, nil)
+		for _, id := range []string{a.ID, b.ID} {
+			_, _ = updateTweet(id, func(tw *Tweet) { tw.Status = scheduledStatus; tw.ScheduledAt = &past })
+		}
+		_, _ = updateTweet(later.ID, func(tw *Tweet) { tw.Status = scheduledStatus; tw.ScheduledAt = &future })
+
+		st := workerState{Interval: "30s"}
+		workerTick(twClient{dry: true, quiet: true}, &st, Ctx{JSON: true})
+		if st.Posted != 1 || st.Failed != 0 {
+			t.Fatalf("posted=%d failed=%d", st.Posted, st.Failed)
+		}
+		for _, id := range []string{a.ID, b.ID} {
+			got, _ := getTweet(id)
+			if got.Status != postedStatus {
+				t.Fatalf("not posted: %+v", got)
+			}
+		}
+		if st.Next == nil || st.Next.ID != later.ID {
+			t.Fatalf("next=%+v", st.Next)
+		}
+		res, err := statusCmd(nil, Ctx{JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := res.(map[string]any)
+		if m["workerAlive"] != true || m["due"] != 0 {
+			t.Fatalf("status=%+v", m)
+		}
+	})
+}
+
+func TestWorkerClaimsDueTweetsOnce(t *testing.T) {
+	withTempCwd(t, func() {
+		ctx := Ctx{JSON: true}
+		past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		tw, _ := createTweet("due", nil, 0, nil)
+		_, _ = updateTweet(tw.ID, func(x *Tweet) { x.Status = scheduledStatus; x.ScheduledAt = &past })
+
+		release, err := holdLock(workerLockPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := workerCmd([]string{"--once", "--dry"}, ctx); err == nil || err.(*CliErr).Code != "WORKER_RUNNING" {
+			t.Fatalf("second worker err=%v", err)
+		}
+		if ok, err := claimDue(&tw); err != nil || !ok {
+			t.Fatalf("claim ok=%v err=%v", ok, err)
+		}
+		if ok, _ := claimDue(&tw); ok {
+			t.Fatal("tweet claimed twice")
+		}
+		if got, _ := getTweet(tw.ID); got.Status != postingStatus {
+			t.Fatalf("status=%s", got.Status)
+		}
+		if _, err := postCmd([]string{tw.ID, "--dry"}, ctx); err == nil || err.(*CliErr).Code != "CONFLICT" {
+			t.Fatalf("post while claimed err=%v", err)
+		}
+		releaseClaim(&tw, errors.New("boom"))
+		if got, _ := getTweet(tw.ID); got.Status != failedStatus || got.Error != "boom" {
+			t.Fatalf("after release=%+v", got)
+		}
+		release()
+		if _, err := os.Stat(workerLockPath()); !os.IsNotExist(err) {
+			t.Fatalf("worker.lock left behind: %v", err)
+		}
+	})
+}
+
+func TestWorkerSkipsFlaggedDrafts(t *testing.T) {
+	withTempCwd(t, func() {
+		past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		flagged, _ := createTweet("like and retweet", nil, 0, nil)
+		accepted, _ := createTweet("like and retweet, on purpose", nil, 0, nil)
+		for _, tw := range []Tweet{flagged, accepted} {
+			_, _ = updateTweet(tw.ID, func(x *Tweet) {
+				x.Status, x.ScheduledAt, x.Flags = scheduledStatus, &past, []string{`uses "like and retweet"`}
+				x.FlagsAccepted = x.ID == accepted.ID
+			})
+		}
+		st := workerState{Interval: "30s"}
+		workerTick(twClient{dry: true, quiet: true}, &st, Ctx{JSON: true})
+		if st.Posted != 1 || st.Failed != 1 {
+			t.Fatalf("posted=%d failed=%d", st.Posted, st.Failed)
+		}
+		if got, _ := getTweet(flagged.ID); got.Status != failedStatus || !strings.Contains(got.Error, "flagged") {
+			t.Fatalf("flagged=%+v", got)
+		}
+		if got, _ := getTweet(accepted.ID); got.Status != postedStatus {
+			t.Fatalf("accepted=%+v", got)
+		}
+	})
+}